@@ -0,0 +1,102 @@
+package board
+
+import (
+	"context"
+	"sync"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+)
+
+// Event types pushed to the merchant board.
+const (
+	OrderPaid      = "order.paid"
+	OrderCancelled = "order.cancelled"
+	OrderAssigned  = "order.assigned"
+)
+
+// eventTypes maps the statuses a merchant is told about to their event type.
+var eventTypes = map[string]string{
+	lifecycle.Paid:      OrderPaid,
+	lifecycle.Cancelled: OrderCancelled,
+	lifecycle.Assigned:  OrderAssigned,
+}
+
+// Board is the per-store log of order events merchants watch. Events are
+// persisted with a sequence number per store so a client can resume after a
+// reconnect; subscribers are only woken up and read the log themselves.
+type Board struct {
+	events repository.MerchantEventRepository
+
+	mu      sync.Mutex
+	waiters map[models.StoreID]map[chan struct{}]struct{}
+}
+
+func NewBoard(events repository.MerchantEventRepository) *Board {
+	return &Board{events: events, waiters: make(map[models.StoreID]map[chan struct{}]struct{})}
+}
+
+// Record is a lifecycle.Recorder that stores the changes a merchant needs to
+// see on their board, in the same transaction as the transition.
+func (b *Board) Record(ctx context.Context, order models.Order, change models.StatusChange) error {
+	eventType, ok := eventTypes[change.To]
+	if !ok {
+		return nil
+	}
+	event := models.MerchantEvent{StoreID: order.StoreID, Type: eventType, Order: models.NewBoardOrder(order), Change: change, At: change.At}
+	_, err := b.events.Append(ctx, event)
+	return err
+}
+
+// OrderTransitioned is a lifecycle.Listener that wakes the store's
+// subscribers once a transition recorded on the board has committed.
+func (b *Board) OrderTransitioned(order models.Order, change models.StatusChange) {
+	if _, ok := eventTypes[change.To]; ok {
+		b.wake(order.StoreID)
+	}
+}
+
+// Latest returns the sequence number of the store's newest event, or zero.
+func (b *Board) Latest(ctx context.Context, storeID models.StoreID) (int64, error) {
+	return b.events.Latest(ctx, storeID)
+}
+
+// Since returns up to limit of the store's events after seq, oldest first.
+func (b *Board) Since(ctx context.Context, storeID models.StoreID, seq int64, limit int64) ([]models.MerchantEvent, error) {
+	return b.events.Since(ctx, storeID, seq, limit)
+}
+
+// Subscribe returns a channel that receives a value whenever this instance
+// records an event for the store, and a function that ends the subscription.
+// Wake-ups carry no data and may be coalesced; read the log with Since.
+func (b *Board) Subscribe(storeID models.StoreID) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	b.mu.Lock()
+	if b.waiters[storeID] == nil {
+		b.waiters[storeID] = make(map[chan struct{}]struct{})
+	}
+	b.waiters[storeID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.waiters[storeID], ch)
+		if len(b.waiters[storeID]) == 0 {
+			delete(b.waiters, storeID)
+		}
+	}
+}
+
+func (b *Board) wake(storeID models.StoreID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.waiters[storeID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrItemNotFound    = errors.New("item not found in store catalog")
+	ErrEmptyOrder      = errors.New("order has no items")
+	ErrInvalidQuantity = errors.New("item quantity must be positive")
+)
+
+// Item is the catalog entry the service prices orders against.
+type Item struct {
+	ID          primitive.ObjectID `bson:"_id" json:"id"`
+	StoreID     models.StoreID     `bson:"storeID" json:"storeID"`
+	Name        string             `bson:"name" json:"name"`
+	Description string             `bson:"description" json:"description"`
+	Price       float64            `bson:"price" json:"price"`
+}
+
+// PriceSource looks up the authoritative price of an item sold by a store.
+type PriceSource interface {
+	Item(ctx context.Context, storeID models.StoreID, itemID primitive.ObjectID) (Item, error)
+}
+
+// MongoSource reads items from the store catalog collection.
+type MongoSource struct {
+	collection *mongo.Collection
+}
+
+func NewMongoSource(collection *mongo.Collection) *MongoSource {
+	return &MongoSource{collection: collection}
+}
+
+func (s *MongoSource) Item(ctx context.Context, storeID models.StoreID, itemID primitive.ObjectID) (Item, error) {
+	var item Item
+	err := s.collection.FindOne(ctx, bson.M{"_id": itemID, "storeID": storeID}).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return item, ErrItemNotFound
+	}
+	return item, err
+}
+
+// MemorySource serves items from a map instead of the catalog collection.
+type MemorySource struct {
+	mu    sync.RWMutex
+	items map[primitive.ObjectID]Item
+}
+
+func NewMemorySource(items ...Item) *MemorySource {
+	s := &MemorySource{items: make(map[primitive.ObjectID]Item)}
+	for _, item := range items {
+		s.Put(item)
+	}
+	return s
+}
+
+// Put adds or replaces an item.
+func (s *MemorySource) Put(item Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[item.ID] = item
+}
+
+func (s *MemorySource) Item(_ context.Context, storeID models.StoreID, itemID primitive.ObjectID) (Item, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	item, ok := s.items[itemID]
+	if !ok || item.StoreID != storeID {
+		return Item{}, ErrItemNotFound
+	}
+	return item, nil
+}
+
+// MismatchError is returned when the total sent by the client does not match
+// the total computed from catalog prices.
+type MismatchError struct {
+	Submitted float64
+	Computed  float64
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("order total %.2f does not match computed total %.2f", e.Submitted, e.Computed)
+}
+
+// PriceOrder replaces the prices on every item with catalog prices, fills in
+// line totals and sets TotalAmount. The submitted TotalAmount must agree with
+// the computed one.
+func PriceOrder(ctx context.Context, src PriceSource, order *models.Order) error {
+	if len(order.Items) == 0 {
+		return ErrEmptyOrder
+	}
+
+	var total float64
+	for i := range order.Items {
+		line := &order.Items[i]
+		if line.Quantity <= 0 {
+			return fmt.Errorf("%w: %s", ErrInvalidQuantity, line.ItemID.Hex())
+		}
+
+		item, err := src.Item(ctx, order.StoreID, line.ItemID)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, line.ItemID.Hex())
+		}
+
+		line.Name = item.Name
+		line.Description = item.Description
+		line.Price = item.Price
+		line.LineTotal = RoundCents(item.Price * float64(line.Quantity))
+		total += line.LineTotal
+	}
+	total = RoundCents(total)
+
+	if math.Abs(order.TotalAmount-total) >= 0.005 {
+		return &MismatchError{Submitted: order.TotalAmount, Computed: total}
+	}
+
+	order.TotalAmount = total
+	return nil
+}
+
+// RoundCents rounds an amount to two decimal places.
+func RoundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// GetAbandonedCarts handles the endpoint for listing carts that have not been
+// checked out within the given number of hours.
+func GetAbandonedCarts(c *gin.Context, carts repository.CartRepository, abandonedAfter time.Duration) {
+	if hours := c.Query("hours"); hours != "" {
+		n, err := strconv.Atoi(hours)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "hours must be a positive integer"})
+			return
+		}
+		abandonedAfter = time.Duration(n) * time.Hour
+	}
+
+	abandoned, err := carts.ListAbandoned(context.Background(), time.Now().UTC().Add(-abandonedAfter))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve carts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, abandoned)
+}
+
+// GetFailedRefunds handles the endpoint for listing orders holding a refund
+// the gateway rejected or failed to settle.
+func GetFailedRefunds(c *gin.Context, orders repository.OrderRepository) {
+	failed, err := orders.ListFailedRefunds(context.Background())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, failed)
+}
+
+// RetryRefund handles the endpoint for sending a failed refund to the gateway
+// again. The refund is marked as initiated first so it is only retried once
+// at a time.
+func RetryRefund(c *gin.Context, orders repository.OrderRepository, gateway payment.Gateway) {
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+	refundID, ok := objectIDParam(c, "refundID", "refund")
+	if !ok {
+		return
+	}
+
+	order, err := orders.Get(context.Background(), orderID, repository.Scope{})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	var refund *models.Refund
+	for i := range order.Refunds {
+		if order.Refunds[i].ID == refundID {
+			refund = &order.Refunds[i]
+		}
+	}
+	if refund == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+		return
+	}
+
+	err = orders.UpdateRefund(context.Background(), orderID, refundID, payment.RefundFailed, refund.RefundID, payment.RefundInitiated)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Refund has not failed or is already being retried"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update refund"})
+		return
+	}
+
+	paymentID := refund.PaymentID
+	if paymentID == "" {
+		paymentID = order.Payment.PaymentID
+	}
+	issued, err := gateway.Refund(c.Request.Context(), paymentID, refund.Amount)
+	if err != nil {
+		log.Printf("payment: retrying refund %s of order %s failed: %v", refundID.Hex(), orderID.Hex(), err)
+		if err := orders.UpdateRefund(context.Background(), orderID, refundID, payment.RefundInitiated, refund.RefundID, payment.RefundFailed); err != nil {
+			log.Printf("payment: failed to mark refund %s of order %s as failed again: %v", refundID.Hex(), orderID.Hex(), err)
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "The payment gateway rejected the refund"})
+		return
+	}
+
+	refund.RefundID, refund.Status = issued.ID, issued.Status
+	if err := orders.UpdateRefund(context.Background(), orderID, refundID, payment.RefundInitiated, issued.ID, issued.Status); err != nil {
+		log.Printf("payment: refund %s of order %s was issued as %s but could not be recorded: %v", refundID.Hex(), orderID.Hex(), issued.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Refund issued but could not be recorded"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Refund issued", "refund": refund})
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/board"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// boardBatch is how many events are read from the board at a time.
+	boardBatch = 100
+	// boardPollInterval is how often the board is re-read without a wake-up,
+	// which picks up events recorded by other instances of the service.
+	boardPollInterval = 5 * time.Second
+	// boardPingInterval is how often the connection is checked, and
+	// boardWriteTimeout how long a single write may take.
+	boardPingInterval = 30 * time.Second
+	boardWriteTimeout = 10 * time.Second
+)
+
+// BoardUpgrader returns the upgrader for the order board. CORS does not
+// cover WebSocket handshakes and the browser sends the session cookie along,
+// so the Origin is checked here: it must be the service's own host or one of
+// allowedOrigins. Clients that send no Origin are not browsers and are let in.
+func BoardUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	return &websocket.Upgrader{CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range allowedOrigins {
+			if strings.EqualFold(origin, allowed) {
+				return true
+			}
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}}
+}
+
+// MerchantBoard handles the WebSocket endpoint for a merchant's live order
+// board. Each message is a board event with its sequence number; a client
+// reconnecting with ?since=<last seq> receives everything it missed, and a
+// client without since only receives new events.
+func MerchantBoard(c *gin.Context, orderBoard *board.Board, stores repository.StoreRepository, upgrader *websocket.Upgrader, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	merchantID := models.MerchantID(accountID)
+
+	storeID, ok := merchantStore(c, stores, merchantID)
+	if !ok {
+		return
+	}
+
+	// Subscribe before reading the board so no event slips in between
+	wake, unsubscribe := orderBoard.Subscribe(storeID)
+	defer unsubscribe()
+
+	var seq int64
+	var err error
+	if since := c.Query("since"); since != "" {
+		seq, err = strconv.ParseInt(since, 10, 64)
+		if err != nil || seq < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since sequence number"})
+			return
+		}
+	} else {
+		seq, err = orderBoard.Latest(context.Background(), storeID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read order board"})
+			return
+		}
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written the error response
+		return
+	}
+	defer conn.Close()
+
+	// The client only sends control frames; reading them notices when it leaves
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	poll := time.NewTicker(boardPollInterval)
+	defer poll.Stop()
+	ping := time.NewTicker(boardPingInterval)
+	defer ping.Stop()
+
+	for {
+		// Send everything after seq, in batches
+		for {
+			events, err := orderBoard.Since(context.Background(), storeID, seq, boardBatch)
+			if err != nil {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "failed to read order board"), time.Now().Add(boardWriteTimeout))
+				return
+			}
+			for _, event := range events {
+				conn.SetWriteDeadline(time.Now().Add(boardWriteTimeout))
+				if err := conn.WriteJSON(event); err != nil {
+					return
+				}
+				seq = event.Seq
+			}
+			if len(events) < boardBatch {
+				break
+			}
+		}
+
+		select {
+		case <-closed:
+			return
+		case <-wake:
+		case <-poll.C:
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(boardWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBoardUpgraderChecksOrigin(t *testing.T) {
+	upgrader := BoardUpgrader([]string{"https://merchant.example.com"})
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no origin", "", true},
+		{"same host", "http://orders.example.com", true},
+		{"allowed origin", "https://merchant.example.com", true},
+		{"other origin", "https://evil.example.com", false},
+		{"allowed host on another scheme", "http://merchant.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://orders.example.com/api/v1/merchant/board", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := upgrader.CheckOrigin(r); got != tt.want {
+				t.Errorf("CheckOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
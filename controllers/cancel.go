@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// cancelOrder cancels the order with the given ID within scope under the
+// cancellation policy, refunds what was paid less any fee and writes the JSON
+// response.
+func cancelOrder(c *gin.Context, orders repository.OrderRepository, gateway payment.Gateway, policy lifecycle.CancellationPolicy, orderID primitive.ObjectID, scope repository.Scope, t lifecycle.Transition, notFound string) {
+	t.To = lifecycle.Cancelled
+	t.Guard = policy.Guard(t.By)
+
+	order, err := orders.Transition(context.Background(), orderID, scope, t)
+	if err != nil {
+		respondTransitionError(c, err, notFound)
+		return
+	}
+
+	// Give the money back if the order had been paid for
+	if order.Payment.Status != payment.StatusPaid {
+		c.JSON(http.StatusOK, gin.H{"message": "Order canceled successfully"})
+		return
+	}
+
+	from := order.History[len(order.History)-1].From
+	fee := policy.Fee(t.By, from, order.Payment.Amount)
+	if order.Payment.Amount-fee <= 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Order canceled successfully", "fee": fee})
+		return
+	}
+
+	refund, err := refundOrder(c.Request.Context(), orders, gateway, order, order.Payment.Amount-fee, fee, "Order cancelled")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order cancelled but the refund could not be recorded"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order canceled successfully", "refund": refund})
+}
+
+// bindCancellationReason reads the mandatory reason code, and an optional
+// note, for a cancellation by a merchant or delivery agent.
+func bindCancellationReason(c *gin.Context, role lifecycle.Role) (string, string, bool) {
+	var body struct {
+		ReasonCode string `json:"reasonCode" binding:"required"`
+		Note       string `json:"note"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason code is required", "reasonCodes": lifecycle.ReasonCodes(role)})
+		return "", "", false
+	}
+
+	if err := lifecycle.CheckReasonCode(role, body.ReasonCode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "reasonCodes": lifecycle.ReasonCodes(role)})
+		return "", "", false
+	}
+
+	return body.ReasonCode, body.Note, true
+}
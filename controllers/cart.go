@@ -0,0 +1,116 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/CS559-CSD-IITBH/order-service/catalog"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddCartItem handles the endpoint for adding an item to the user's cart.
+func AddCartItem(c *gin.Context, carts repository.CartRepository, prices catalog.PriceSource, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	var body struct {
+		StoreID  models.StoreID     `json:"storeID" binding:"required"`
+		ItemID   primitive.ObjectID `json:"itemID" binding:"required"`
+		Quantity int                `json:"quantity" binding:"required,min=1"`
+		Replace  bool               `json:"replace"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	item, err := prices.Item(c.Request.Context(), body.StoreID, body.ItemID)
+	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
+
+	line := models.OrderItem{
+		ItemID:      item.ID,
+		Name:        item.Name,
+		Description: item.Description,
+		Quantity:    body.Quantity,
+		Price:       item.Price,
+	}
+
+	cart, err := carts.AddItem(context.Background(), userID, body.StoreID, line, body.Replace)
+	respondWithCart(c, cart, err)
+}
+
+// UpdateCartItem handles the endpoint for changing the quantity of an item in the user's cart.
+func UpdateCartItem(c *gin.Context, carts repository.CartRepository, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	itemID, ok := objectIDParam(c, "itemID", "item")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Quantity int `json:"quantity" binding:"required,min=1"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	cart, err := carts.SetQuantity(context.Background(), userID, itemID, body.Quantity)
+	respondWithCart(c, cart, err)
+}
+
+// RemoveCartItem handles the endpoint for removing an item from the user's cart.
+func RemoveCartItem(c *gin.Context, carts repository.CartRepository, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	itemID, ok := objectIDParam(c, "itemID", "item")
+	if !ok {
+		return
+	}
+
+	cart, err := carts.RemoveItem(context.Background(), userID, itemID)
+	respondWithCart(c, cart, err)
+}
+
+// ClearCart handles the endpoint for emptying the user's cart.
+func ClearCart(c *gin.Context, carts repository.CartRepository, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	if err := carts.Clear(context.Background(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.Order{UserID: userID, Items: []models.OrderItem{}})
+}
+
+// respondWithCart returns the user's cart after a change, or the error
+// response for the change.
+func respondWithCart(c *gin.Context, cart models.Order, err error) {
+	switch {
+	case errors.Is(err, repository.ErrOtherStore):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cart contains items from another store, set replace to start a new cart"})
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found in cart"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+	default:
+		c.JSON(http.StatusOK, cart)
+	}
+}
@@ -2,20 +2,27 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/CS559-CSD-IITBH/order-service/catalog"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
 	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/CS559-CSD-IITBH/order-service/tracking"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // SaveCart handles the endpoint for saving the user's cart.
-func SaveCart(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+func SaveCart(c *gin.Context, carts repository.CartRepository, prices catalog.PriceSource, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	userID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
 
 	var cart models.Order
 	if err := c.BindJSON(&cart); err != nil {
@@ -23,30 +30,47 @@ func SaveCart(c *gin.Context, collection *mongo.Collection, storeSession *sessio
 		return
 	}
 
-	// Define the filter to find the existing cart
-	filter := bson.M{"userID": userID}
+	// A cart only holds items sold by its store, and is priced from the
+	// catalog rather than the prices the client sent
+	items := make([]models.OrderItem, 0, len(cart.Items))
+	for _, line := range cart.Items {
+		if line.Quantity <= 0 {
+			respondPricingError(c, catalog.ErrInvalidQuantity)
+			return
+		}
+		item, err := prices.Item(c.Request.Context(), cart.StoreID, line.ItemID)
+		if err != nil {
+			respondPricingError(c, err)
+			return
+		}
+		items = append(items, models.OrderItem{
+			ItemID:      item.ID,
+			Name:        item.Name,
+			Description: item.Description,
+			Quantity:    line.Quantity,
+			Price:       item.Price,
+		})
+	}
+	cart.Items = items
 
-	// Replace the existing cart or insert a new one
-	_, err := collection.ReplaceOne(context.Background(), filter, cart, options.Replace().SetUpsert(true))
+	// Replace the existing cart contents or insert a new one
+	saved, err := carts.Upsert(context.Background(), userID, cart)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save cart to MongoDB"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Cart saved successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Cart saved successfully", "cart": saved})
 }
 
 // GetCart handles the endpoint for retrieving the user's cart.
-func GetCart(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+func GetCart(c *gin.Context, carts repository.CartRepository, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	userID, _ := session.Values["user_id"].(uint)
-
-	// Define the filter to find the existing cart
-	filter := bson.M{"userID": userID}
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
 
 	// Find the cart based on the user ID
-	var existingCart models.Order
-	err := collection.FindOne(context.Background(), filter).Decode(&existingCart)
+	existingCart, err := carts.Get(context.Background(), userID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
 		return
@@ -56,72 +80,209 @@ func GetCart(c *gin.Context, collection *mongo.Collection, storeSession *session
 }
 
 // PlaceOrder handles the endpoint for placing a new order.
-func PlaceOrder(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+func PlaceOrder(c *gin.Context, orders repository.OrderRepository, prices catalog.PriceSource, gateway payment.Gateway, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	userID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
 
-	var newOrder models.Order
-	if err := c.BindJSON(&newOrder); err != nil {
+	// Only what the customer chooses is read from the request, everything
+	// else on the order is set by the server
+	var body struct {
+		StoreID models.StoreID `json:"storeID" binding:"required"`
+		Items   []struct {
+			ItemID   primitive.ObjectID `json:"id" binding:"required"`
+			Quantity int                `json:"quantity" binding:"required,min=1"`
+		} `json:"items" binding:"required,min=1,dive"`
+		// A pointer so that a missing total is told apart from zero
+		TotalAmount *float64 `json:"totalAmount" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 		return
 	}
 
-	newOrder.UserID = userID
-	newOrder.Status = "Paid"
+	items := make([]models.OrderItem, 0, len(body.Items))
+	for _, item := range body.Items {
+		items = append(items, models.OrderItem{ItemID: item.ItemID, Quantity: item.Quantity})
+	}
 
-	_, err := collection.InsertOne(context.Background(), newOrder)
+	newOrder, err := prepareOrder(c.Request.Context(), prices, userID, body.StoreID, items, *body.TotalAmount)
 	if err != nil {
+		respondPricingError(c, err)
+		return
+	}
+
+	if err := startPayment(c.Request.Context(), gateway, &newOrder); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create payment"})
+		return
+	}
+
+	if err := orders.Insert(context.Background(), newOrder); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Order placed successfully"})
+	respondOrderPlaced(c, gateway, newOrder)
 }
 
-// CancelOrder handles the endpoint for canceling an existing order.
-func CancelOrder(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+// Checkout handles the endpoint for turning the user's saved cart into an order.
+func Checkout(c *gin.Context, orders repository.OrderRepository, carts repository.CartRepository, tx repository.Transactor, prices catalog.PriceSource, gateway payment.Gateway, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	userID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
 
-	orderID := c.Param("orderID")
+	cart, err := carts.Get(context.Background(), userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return
+	}
 
-	existingOrder := models.Order{}
-	err := collection.FindOne(context.Background(), bson.M{"_id": orderID, "userID": userID}).Decode(&existingOrder)
+	// The cart total is what the user last saw, so it must still match the catalog
+	items := make([]models.OrderItem, 0, len(cart.Items))
+	for _, line := range cart.Items {
+		items = append(items, models.OrderItem{ItemID: line.ItemID, Quantity: line.Quantity})
+	}
+	newOrder, err := prepareOrder(c.Request.Context(), prices, userID, cart.StoreID, items, cart.TotalAmount)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the user"})
+		respondPricingError(c, err)
 		return
 	}
 
-	if existingOrder.Status == "Cancelled" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Order status is already cancelled"})
+	// Clear the cart and create the order together. The cart goes first so a
+	// repeated checkout of the same cart stops before placing a second order,
+	// even where transactions are unavailable. Only the checkout that placed
+	// the order goes on to create a gateway order for it.
+	err = tx.WithTransaction(context.Background(), func(ctx context.Context) error {
+		if err := carts.Delete(ctx, userID, cart.OrderID); err != nil {
+			return err
+		}
+		return orders.Insert(ctx, newOrder)
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cart was already checked out"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place order"})
 		return
 	}
 
-	update := bson.M{"$set": bson.M{"status": "Cancelled"}}
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": existingOrder.OrderID, "userID": userID}, update)
+	err = startPayment(c.Request.Context(), gateway, &newOrder)
+	if err == nil {
+		err = orders.SetPayment(context.Background(), newOrder.OrderID, newOrder.Payment)
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel order"})
+		// Undo the checkout so the customer can try again with the same cart
+		abandonCheckout(context.Background(), orders, carts, cart, newOrder)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to create payment"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order canceled successfully"})
+	respondOrderPlaced(c, gateway, newOrder)
+}
+
+// abandonCheckout cancels an order whose payment could not be started and
+// puts the customer's cart back. Failures are only logged, the customer is
+// already being told that the checkout failed.
+func abandonCheckout(ctx context.Context, orders repository.OrderRepository, carts repository.CartRepository, cart, order models.Order) {
+	_, err := orders.Transition(ctx, order.OrderID, repository.Scope{},
+		lifecycle.Transition{To: lifecycle.Cancelled, By: lifecycle.Customer, ActorID: uint(order.UserID), Reason: "Payment could not be started"})
+	if err != nil {
+		log.Printf("checkout: cancelling order %s without payment: %v", order.OrderID.Hex(), err)
+	}
+	if _, err := carts.Upsert(ctx, order.UserID, cart); err != nil {
+		log.Printf("checkout: restoring cart of user %d: %v", order.UserID, err)
+	}
+}
+
+// prepareOrder builds a new order for the items, priced from the catalog.
+// total is the amount the customer was shown and must match the catalog.
+func prepareOrder(ctx context.Context, prices catalog.PriceSource, userID models.UserID, storeID models.StoreID, items []models.OrderItem, total float64) (models.Order, error) {
+	order := models.Order{StoreID: storeID, Items: items, TotalAmount: total}
+	if err := catalog.PriceOrder(ctx, prices, &order); err != nil {
+		return order, err
+	}
+
+	order.OrderID = primitive.NewObjectID()
+	order.UserID = userID
+	order.CreatedAt = time.Now().UTC()
+	order.UpdatedAt = order.CreatedAt
+	order.Status = lifecycle.PendingPayment
+	// Stored as empty arrays rather than null so later updates can $push
+	order.Refunds = []models.Refund{}
+	order.Adjustments = []models.Adjustment{}
+	order.History = []models.StatusChange{
+		lifecycle.Transition{To: lifecycle.PendingPayment, By: lifecycle.Customer, ActorID: uint(userID)}.Change(""),
+	}
+	return order, nil
+}
+
+// CancelOrder handles the endpoint for canceling an existing order.
+func CancelOrder(c *gin.Context, orders repository.OrderRepository, gateway payment.Gateway, policy lifecycle.CancellationPolicy, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	// The cancellation reason is optional, so an empty body is accepted.
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	_ = c.ShouldBindJSON(&body)
+
+	cancelOrder(c, orders, gateway, policy, orderID, repository.User(userID),
+		lifecycle.Transition{By: lifecycle.Customer, ActorID: uint(userID), Reason: body.Reason},
+		"Order not found or does not belong to the user")
 }
 
 // TrackOrder handles the endpoint for tracking the status of an order.
-func TrackOrder(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+func TrackOrder(c *gin.Context, orders repository.OrderRepository, tracker *tracking.Tracker, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	userID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
 
-	orderID := c.Param("orderID")
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
 
-	// Retrieve the order from the MongoDB collection
-	var order models.Order
-	err := collection.FindOne(context.Background(), bson.M{"_id": orderID, "userID": userID}).Decode(&order)
+	// Retrieve the order if it belongs to the user
+	order, err := orders.Get(context.Background(), orderID, repository.User(userID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the user"})
 		return
 	}
 
-	// Return the order status in the response
-	c.JSON(http.StatusOK, gin.H{"status": order.Status})
+	// The delivery agent's trail, empty until an agent reports a position
+	trail, err := tracker.Trail(context.Background(), order.OrderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve delivery location"})
+		return
+	}
+
+	// Return the order status, its timeline, any refunds and where the agent is
+	c.JSON(http.StatusOK, gin.H{
+		"status":   order.Status,
+		"history":  order.History,
+		"refunds":  order.Refunds,
+		"location": order.DeliveryInfo.LastLocation,
+		"trail":    trail,
+	})
+}
+
+// respondPricingError maps catalog pricing errors onto HTTP responses.
+func respondPricingError(c *gin.Context, err error) {
+	var mismatch *catalog.MismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "totalAmount": mismatch.Computed})
+	case errors.Is(err, catalog.ErrItemNotFound), errors.Is(err, catalog.ErrEmptyOrder), errors.Is(err, catalog.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to price order"})
+	}
 }
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/CS559-CSD-IITBH/order-service/catalog"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPrepareOrderStoresEmptyArrays(t *testing.T) {
+	storeID := models.NewStoreID()
+	item := catalog.Item{ID: primitive.NewObjectID(), StoreID: storeID, Name: "Tea", Price: 2.5}
+	prices := catalog.NewMemorySource(item)
+
+	order, err := prepareOrder(context.Background(), prices, 7, storeID,
+		[]models.OrderItem{{ItemID: item.ID, Quantity: 2}}, 5)
+	if err != nil {
+		t.Fatalf("prepareOrder: %v", err)
+	}
+
+	raw, err := bson.Marshal(order)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	// MongoDB rejects $push onto a null field
+	for _, field := range []string{"refunds", "adjustments", "history"} {
+		value, err := bson.Raw(raw).LookupErr(field)
+		if err != nil {
+			t.Fatalf("%s is missing: %v", field, err)
+		}
+		if value.Type != bson.TypeArray {
+			t.Errorf("%s is stored as %s, want an array", field, value.Type)
+		}
+	}
+}
+
+// checkoutServer runs Checkout for customer 1, who has a cart of three items.
+type checkoutServer struct {
+	t       *testing.T
+	orders  *repository.MemoryOrders
+	carts   *repository.MemoryCarts
+	gateway *testGateway
+	prices  *catalog.MemorySource
+	session *sessions.FilesystemStore
+	cookie  *http.Cookie
+}
+
+func newCheckoutServer(t *testing.T) *checkoutServer {
+	gin.SetMode(gin.TestMode)
+	item := catalog.Item{ID: primitive.NewObjectID(), StoreID: models.NewStoreID(), Name: "Tea", Price: 2.5}
+	s := &checkoutServer{
+		t:       t,
+		orders:  repository.NewMemoryOrders(),
+		carts:   repository.NewMemoryCarts(),
+		gateway: newTestGateway(t),
+		prices:  catalog.NewMemorySource(item),
+		session: sessions.NewFilesystemStore(t.TempDir(), []byte("test-key")),
+	}
+
+	line := models.OrderItem{ItemID: item.ID, Name: item.Name, Price: item.Price, Quantity: 3}
+	if _, err := s.carts.AddItem(context.Background(), 1, item.StoreID, line, false); err != nil {
+		t.Fatalf("add item: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := s.session.New(req, "session-name")
+	session.Values["user_id"] = uint(1)
+	if err := session.Save(req, rec); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	s.cookie = rec.Result().Cookies()[0]
+	return s
+}
+
+func (s *checkoutServer) checkout() int {
+	req := httptest.NewRequest(http.MethodPost, "/checkout", nil)
+	req.AddCookie(s.cookie)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = req
+	Checkout(c, s.orders, s.carts, repository.MemoryTransactor{}, s.prices, s.gateway, s.session)
+	return rec.Code
+}
+
+func TestCheckoutCreatesOneGatewayOrder(t *testing.T) {
+	s := newCheckoutServer(t)
+
+	var wg sync.WaitGroup
+	codes := make(chan int, 10)
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- s.checkout()
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	placed := 0
+	for code := range codes {
+		switch code {
+		case http.StatusCreated:
+			placed++
+		case http.StatusConflict, http.StatusNotFound:
+		default:
+			t.Errorf("checkout got %d", code)
+		}
+	}
+	if placed != 1 {
+		t.Errorf("%d checkouts placed an order, want 1", placed)
+	}
+	if s.gateway.orders != 1 {
+		t.Errorf("%d gateway orders were created, want 1", s.gateway.orders)
+	}
+
+	orders, _ := s.orders.ListByUser(context.Background(), 1)
+	if len(orders) != 1 || orders[0].Payment.GatewayOrderID == "" || orders[0].Payment.Amount != 750 {
+		t.Fatalf("customer has %+v, want one order with a gateway order of 750", orders)
+	}
+}
+
+func TestCheckoutWithoutPaymentRestoresCart(t *testing.T) {
+	s := newCheckoutServer(t)
+	s.gateway.failOrders = true
+
+	if code := s.checkout(); code != http.StatusBadGateway {
+		t.Fatalf("checkout got %d, want %d", code, http.StatusBadGateway)
+	}
+
+	orders, _ := s.orders.ListByUser(context.Background(), 1)
+	if len(orders) != 1 || orders[0].Status != lifecycle.Cancelled {
+		t.Errorf("customer has %+v, want one cancelled order", orders)
+	}
+	cart, err := s.carts.Get(context.Background(), 1)
+	if err != nil || len(cart.Items) != 1 || cart.Items[0].Quantity != 3 {
+		t.Fatalf("cart is %+v, %v; want the three items back", cart, err)
+	}
+
+	// Once the gateway is back the same cart checks out
+	s.gateway.failOrders = false
+	if code := s.checkout(); code != http.StatusCreated {
+		t.Errorf("retried checkout got %d, want %d", code, http.StatusCreated)
+	}
+}
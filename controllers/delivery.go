@@ -2,105 +2,225 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/CS559-CSD-IITBH/order-service/dispatch"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
 	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/notification"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/CS559-CSD-IITBH/order-service/tracking"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// GetOrdersForDelivery handles the endpoint for retrieving orders for a delivery agent.
-func GetOrdersForDelivery(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+// GetOrdersForDelivery handles the endpoint for retrieving orders for a
+// delivery agent, along with the open orders they can accept.
+func GetOrdersForDelivery(c *gin.Context, orders repository.OrderRepository, pool *dispatch.Pool, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	deliveryAgentID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
 
 	// Query orders for the specific delivery agent
-	cursor, err := collection.Find(context.Background(), bson.M{"deliveryInfo.deliveryAgentID": deliveryAgentID})
+	agentOrders, err := orders.ListByAgent(context.Background(), deliveryAgentID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
 		return
 	}
-	defer cursor.Close(context.Background())
 
-	var orders []models.Order
-	if err := cursor.All(context.Background(), &orders); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode orders"})
+	// Orders waiting for an agent, offered only while this agent can take more
+	offers, err := pool.OffersFor(context.Background(), deliveryAgentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve open orders"})
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
+	c.JSON(http.StatusOK, gin.H{"orders": agentOrders, "offers": offers})
 }
 
-// AcceptOrder handles the endpoint for a delivery agent accepting an order.
-func AcceptOrder(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+// GetAgentStatus handles the endpoint for a delivery agent checking their availability.
+func GetAgentStatus(c *gin.Context, agents *dispatch.Agents, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	deliveryAgentID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
+
+	agent, err := agents.Get(context.Background(), deliveryAgentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve agent status"})
+		return
+	}
 
-	orderID := c.Param("orderID")
+	c.JSON(http.StatusOK, agent)
+}
 
-	// Check if the order exists and is assigned to the delivery agent
-	existingOrder := models.Order{}
-	err := collection.FindOne(context.Background(), bson.M{"_id": orderID, "deliveryInfo.deliveryAgentID": deliveryAgentID}).Decode(&existingOrder)
+// GoOnline handles the endpoint for a delivery agent starting a shift. The
+// agent may set how many orders they can carry at once.
+func GoOnline(c *gin.Context, agents *dispatch.Agents, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
+
+	// The capacity is optional, so an empty body is accepted.
+	var body struct {
+		Capacity int `json:"capacity"`
+	}
+	_ = c.ShouldBindJSON(&body)
+
+	agent, err := agents.GoOnline(context.Background(), deliveryAgentID, body.Capacity)
+	if errors.Is(err, dispatch.ErrInvalidCapacity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the delivery agent"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to go online"})
+		return
+	}
+
+	c.JSON(http.StatusOK, agent)
+}
+
+// GoOffline handles the endpoint for a delivery agent ending a shift.
+func GoOffline(c *gin.Context, agents *dispatch.Agents, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
+
+	agent, err := agents.GoOffline(context.Background(), deliveryAgentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to go offline"})
+		return
+	}
+
+	c.JSON(http.StatusOK, agent)
+}
+
+// AcceptOrder handles the endpoint for a delivery agent accepting an open
+// order. The first agent to accept gets the order.
+func AcceptOrder(c *gin.Context, pool *dispatch.Pool, issuer *otp.Issuer, notifier *notification.Dispatcher, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
 		return
 	}
 
-	// Check if the order is in the correct status for acceptance
-	if existingOrder.Status != "Ready" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot accept order. Order status is not ready"})
+	// The agent shows the pickup OTP to the merchant when collecting the order
+	code, pickupOTP, err := issuer.Issue(otp.Pickup)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate pickup OTP"})
 		return
 	}
 
-	// Update the order status to "Assigned"
-	update := bson.M{"$set": bson.M{"status": "Assigned"}}
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": existingOrder.OrderID, "deliveryInfo.deliveryAgentID": deliveryAgentID}, update)
+	order, err := pool.Claim(context.Background(), orderID, deliveryAgentID, bson.M{"pickupOTP": pickupOTP})
+	if errors.Is(err, dispatch.ErrAgentUnavailable) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Go online, or deliver your current orders, before accepting more"})
+		return
+	}
+	if errors.Is(err, dispatch.ErrClaimInProgress) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another order is being accepted, try again in a moment"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept order"})
+		respondTransitionError(c, err, "Order not found or already taken by another delivery agent")
 		return
 	}
 
+	notifier.SendOTP(notification.EventPickupOTP, order, code)
+
 	c.JSON(http.StatusOK, gin.H{"message": "Order accepted successfully"})
 }
 
-// VerifyDelivery handles the endpoint for verifying the delivery of an order by a delivery agent.
-func VerifyDelivery(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+// UpdateLocation handles the endpoint for a delivery agent reporting their
+// position while carrying an order.
+func UpdateLocation(c *gin.Context, tracker *tracking.Tracker, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	deliveryAgentID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
 
-	orderID := c.Param("orderID")
-	// otp := c.PostForm("otp")
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
 
-	// Check if the order exists and is assigned to the delivery agent
-	existingOrder := models.Order{}
-	err := collection.FindOne(context.Background(), bson.M{"_id": orderID, "deliveryInfo.deliveryAgentID": deliveryAgentID}).Decode(&existingOrder)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the delivery agent"})
+	var body struct {
+		Location   models.GeoPoint `json:"location" binding:"required"`
+		RecordedAt time.Time       `json:"recordedAt"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	location, err := tracker.Record(context.Background(), orderID, deliveryAgentID, body.Location, body.RecordedAt)
+	switch {
+	case errors.Is(err, tracking.ErrInvalidPoint), errors.Is(err, tracking.ErrInvalidTimestamp):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, tracking.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found, not out for delivery or does not belong to the delivery agent"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record location"})
+	default:
+		c.JSON(http.StatusOK, location)
+	}
+}
+
+// CancelOrderByDelivery handles the endpoint for a delivery agent cancelling
+// an order they cannot deliver. A reason code is required.
+func CancelOrderByDelivery(c *gin.Context, orders repository.OrderRepository, gateway payment.Gateway, policy lifecycle.CancellationPolicy, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
 		return
 	}
 
-	// Check if the order is in the correct status for verifying delivery
-	if existingOrder.Status != "In-Transit" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot verify delivery. Order status is not in transit"})
+	reasonCode, note, ok := bindCancellationReason(c, lifecycle.DeliveryAgent)
+	if !ok {
 		return
 	}
 
-	// Verify the OTP (you need to implement this part)
-	// expectedOTP := getExpectedOTP(existingOrder) // Implement a function to retrieve the expected OTP
-	// if otp != expectedOTP {
-	// 	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid OTP"})
-	// 	return
-	// }
+	cancelOrder(c, orders, gateway, policy, orderID, repository.Agent(deliveryAgentID),
+		lifecycle.Transition{By: lifecycle.DeliveryAgent, ActorID: uint(deliveryAgentID), ReasonCode: reasonCode, Reason: note},
+		"Order not found or does not belong to the delivery agent")
+}
+
+// VerifyDelivery handles the endpoint for verifying the delivery of an order by a delivery agent.
+func VerifyDelivery(c *gin.Context, orders repository.OrderRepository, issuer *otp.Issuer, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+	code, ok := bindOTP(c)
+	if !ok {
+		return
+	}
 
-	// Update the order status to "Delivered"
-	update := bson.M{"$set": bson.M{"status": "Delivered"}}
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": existingOrder.OrderID, "deliveryInfo.deliveryAgentID": deliveryAgentID}, update)
+	// Check if the order exists and is assigned to the delivery agent
+	order, err := orders.Get(context.Background(), orderID, repository.Agent(deliveryAgentID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify delivery"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the delivery agent"})
+		return
+	}
+
+	// The customer gives the agent the delivery OTP on handover
+	if !checkOTP(c, orders, issuer, order, otp.Delivery, code) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Delivery verified successfully"})
+	transitionOrder(c, orders, order.OrderID, repository.Scope{},
+		lifecycle.Transition{To: lifecycle.Delivered, By: lifecycle.DeliveryAgent, ActorID: uint(deliveryAgentID), Set: bson.M{"deliveryOTP": nil}},
+		"Order not found or does not belong to the delivery agent", "Delivery verified successfully")
 }
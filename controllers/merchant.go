@@ -2,139 +2,319 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/CS559-CSD-IITBH/order-service/catalog"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
 	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/notification"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// merchantStore looks up the store run by the merchant and writes a 403
+// response when there is none.
+func merchantStore(c *gin.Context, stores repository.StoreRepository, merchantID models.MerchantID) (models.StoreID, bool) {
+	store, err := stores.ForMerchant(context.Background(), merchantID)
+	if errors.Is(err, repository.ErrNoStore) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "No store is registered for the merchant"})
+		return models.StoreID{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve store"})
+		return models.StoreID{}, false
+	}
+	return store.StoreID, true
+}
+
 // GetOrdersForMerchant handles the endpoint for retrieving orders for a specific merchant.
-func GetOrdersForMerchant(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+func GetOrdersForMerchant(c *gin.Context, orders repository.OrderRepository, stores repository.StoreRepository, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	merchantID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	merchantID := models.MerchantID(accountID)
+
+	storeID, ok := merchantStore(c, stores, merchantID)
+	if !ok {
+		return
+	}
 
 	// Query orders for the specific merchant
-	cursor, err := collection.Find(context.Background(), bson.M{"storeID": merchantID})
+	storeOrders, err := orders.ListByStore(context.Background(), storeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
 		return
 	}
-	defer cursor.Close(context.Background())
 
-	var orders []models.Order
-	if err := cursor.All(context.Background(), &orders); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode orders"})
+	c.JSON(http.StatusOK, storeOrders)
+}
+
+// ConfirmOrder handles the endpoint for confirming an order.
+func ConfirmOrder(c *gin.Context, orders repository.OrderRepository, stores repository.StoreRepository, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	merchantID := models.MerchantID(accountID)
+
+	storeID, ok := merchantStore(c, stores, merchantID)
+	if !ok {
+		return
+	}
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, orders)
+	transitionOrder(c, orders, orderID, repository.Store(storeID),
+		lifecycle.Transition{To: lifecycle.Confirmed, By: lifecycle.Merchant, ActorID: uint(merchantID)},
+		"Order not found or does not belong to the merchant", "Order confirmed successfully")
 }
 
-// ConfirmOrder handles the endpoint for confirming an order.
-func ConfirmOrder(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+// AdjustOrder handles the endpoint for a merchant reducing or removing items
+// they cannot supply. The difference is refunded to the customer.
+func AdjustOrder(c *gin.Context, orders repository.OrderRepository, stores repository.StoreRepository, gateway payment.Gateway, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	merchantID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	merchantID := models.MerchantID(accountID)
+
+	storeID, ok := merchantStore(c, stores, merchantID)
+	if !ok {
+		return
+	}
 
-	orderID := c.Param("orderID")
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Items []struct {
+			ItemID   primitive.ObjectID `json:"id" binding:"required"`
+			Quantity int                `json:"quantity" binding:"min=0"`
+		} `json:"items" binding:"required,min=1,dive"`
+		Reason string `json:"reason"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
 
-	// Check if the order exists and belongs to the merchant.
-	existingOrder := models.Order{}
-	err := collection.FindOne(context.Background(), bson.M{"_id": orderID, "storeID": merchantID}).Decode(&existingOrder)
+	order, err := orders.Get(context.Background(), orderID, repository.Store(storeID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the merchant"})
 		return
 	}
 
-	// Check if the order is in the correct status for confirmation.
-	if existingOrder.Status != "Paid" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot confirm order. Order status is not Paid"})
+	if !lifecycle.Adjustable(order.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order can no longer be adjusted"})
+		return
+	}
+
+	quantities := make(map[primitive.ObjectID]int, len(body.Items))
+	for _, item := range body.Items {
+		quantities[item.ItemID] = item.Quantity
+	}
+
+	adjusted, err := adjustItems(&order, quantities)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Update the order status to confirmed.
-	update := bson.M{"$set": bson.M{"status": "Confirmed"}}
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": existingOrder.OrderID, "storeID": merchantID}, update)
+	now := time.Now().UTC()
+	adjustment := models.Adjustment{
+		Items:        adjusted,
+		RefundAmount: order.Payment.Amount - payment.Subunits(order.TotalAmount),
+		MerchantID:   merchantID,
+		Reason:       body.Reason,
+		At:           now,
+	}
+
+	// The payment now only covers the adjusted total
+	order.Payment.Amount = payment.Subunits(order.TotalAmount)
+	err = orders.Adjust(context.Background(), order, adjustment)
+	if errors.Is(err, lifecycle.ErrConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was updated by another request, please retry"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm order"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust order"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order confirmed successfully"})
+	if adjustment.RefundAmount <= 0 || order.Payment.Status != payment.StatusPaid {
+		c.JSON(http.StatusOK, gin.H{"message": "Order adjusted successfully", "adjustment": adjustment})
+		return
+	}
+
+	refund, err := refundOrder(c.Request.Context(), orders, gateway, order, adjustment.RefundAmount, 0, "Order adjusted by merchant")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Order adjusted but the refund could not be recorded"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Order adjusted successfully", "adjustment": adjustment, "refund": refund})
 }
 
-// OrderReadyForPickup handles the endpoint for marking an order as ready for pickup.
-func OrderReadyForPickup(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+// adjustItems lowers item quantities on the order, dropping items whose new
+// quantity is zero, and recomputes the totals. Quantities can only go down and
+// at least one item has to remain.
+func adjustItems(order *models.Order, quantities map[primitive.ObjectID]int) ([]models.AdjustedItem, error) {
+	inOrder := make(map[primitive.ObjectID]bool, len(order.Items))
+	for _, line := range order.Items {
+		inOrder[line.ItemID] = true
+	}
+	for itemID := range quantities {
+		if !inOrder[itemID] {
+			return nil, fmt.Errorf("item %s is not part of the order", itemID.Hex())
+		}
+	}
+
+	var adjusted []models.AdjustedItem
+	var items []models.OrderItem
+	var total float64
+
+	for _, line := range order.Items {
+		quantity, ok := quantities[line.ItemID]
+		if !ok {
+			items = append(items, line)
+			total += line.LineTotal
+			continue
+		}
+
+		if quantity < 0 {
+			return nil, fmt.Errorf("quantity of item %s cannot be negative", line.ItemID.Hex())
+		}
+		if quantity >= line.Quantity {
+			return nil, fmt.Errorf("quantity of item %s can only be reduced", line.ItemID.Hex())
+		}
+		adjusted = append(adjusted, models.AdjustedItem{
+			ItemID:       line.ItemID,
+			Name:         line.Name,
+			FromQuantity: line.Quantity,
+			ToQuantity:   quantity,
+		})
+		if quantity == 0 {
+			continue
+		}
+
+		line.Quantity = quantity
+		line.LineTotal = catalog.RoundCents(line.Price * float64(quantity))
+		items = append(items, line)
+		total += line.LineTotal
+	}
+
+	if len(items) == 0 {
+		return nil, errors.New("an order cannot be adjusted to nothing, cancel it instead")
+	}
+
+	order.Items = items
+	order.TotalAmount = catalog.RoundCents(total)
+	return adjusted, nil
+}
+
+// CancelOrderByMerchant handles the endpoint for a merchant cancelling an
+// order they cannot fulfil. A reason code is required.
+func CancelOrderByMerchant(c *gin.Context, orders repository.OrderRepository, stores repository.StoreRepository, gateway payment.Gateway, policy lifecycle.CancellationPolicy, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	merchantID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	merchantID := models.MerchantID(accountID)
 
-	orderID := c.Param("orderID")
+	storeID, ok := merchantStore(c, stores, merchantID)
+	if !ok {
+		return
+	}
 
-	// Check if the order exists and belongs to the merchant.
-	existingOrder := models.Order{}
-	err := collection.FindOne(context.Background(), bson.M{"_id": orderID, "storeID": merchantID}).Decode(&existingOrder)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the merchant"})
+	orderID, ok := orderIDParam(c)
+	if !ok {
 		return
 	}
 
-	// Check if the order is in the correct status for marking as ready for pickup.
-	if existingOrder.Status != "Confirmed" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot mark order as ready for pickup. Order status is not confirmed"})
+	reasonCode, note, ok := bindCancellationReason(c, lifecycle.Merchant)
+	if !ok {
 		return
 	}
 
-	// Update the order status to ready for pickup.
-	update := bson.M{"$set": bson.M{"status": "Ready"}}
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": existingOrder.OrderID, "storeID": merchantID}, update)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark order as ready for pickup"})
+	cancelOrder(c, orders, gateway, policy, orderID, repository.Store(storeID),
+		lifecycle.Transition{By: lifecycle.Merchant, ActorID: uint(merchantID), ReasonCode: reasonCode, Reason: note},
+		"Order not found or does not belong to the merchant")
+}
+
+// OrderReadyForPickup handles the endpoint for marking an order as ready for pickup.
+func OrderReadyForPickup(c *gin.Context, orders repository.OrderRepository, stores repository.StoreRepository, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	merchantID := models.MerchantID(accountID)
+
+	storeID, ok := merchantStore(c, stores, merchantID)
+	if !ok {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Order marked as ready for pickup"})
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	transitionOrder(c, orders, orderID, repository.Store(storeID),
+		lifecycle.Transition{To: lifecycle.Ready, By: lifecycle.Merchant, ActorID: uint(merchantID)},
+		"Order not found or does not belong to the merchant", "Order marked as ready for pickup")
 }
 
 // VerifyPickup handles the endpoint for verifying pickup by a delivery agent.
-func VerifyPickup(c *gin.Context, collection *mongo.Collection, storeSession *sessions.FilesystemStore) {
+func VerifyPickup(c *gin.Context, orders repository.OrderRepository, stores repository.StoreRepository, issuer *otp.Issuer, notifier *notification.Dispatcher, storeSession *sessions.FilesystemStore) {
 	session, _ := storeSession.Get(c.Request, "session-name")
-	merchantID, _ := session.Values["user_id"].(uint)
+	accountID, _ := session.Values["user_id"].(uint)
+	merchantID := models.MerchantID(accountID)
 
-	orderID := c.Param("orderID")
-	// otp := c.PostForm("otp")
+	storeID, ok := merchantStore(c, stores, merchantID)
+	if !ok {
+		return
+	}
 
-	// Retrieve the order from the MongoDB collection
-	var order models.Order
-	err := collection.FindOne(context.Background(), bson.M{"_id": orderID, "storeID": merchantID}).Decode(&order)
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+	code, ok := bindOTP(c)
+	if !ok {
+		return
+	}
+
+	// Retrieve the order if it belongs to the merchant
+	order, err := orders.Get(context.Background(), orderID, repository.Store(storeID))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the merchant"})
 		return
 	}
 
-	// Check if the order is in the correct status for verifying pickup
-	if order.Status != "Assigned" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot verify pickup. Order status is not assigned for pickup"})
+	// The delivery agent shows the merchant the pickup OTP
+	if !checkOTP(c, orders, issuer, order, otp.Pickup, code) {
 		return
 	}
 
-	// Check if the provided OTP matches the expected OTP (you need to implement this part)
-	// expectedOTP := generateExpectedOTP() // You need to implement this function
-	// if otp != expectedOTP {
-	// 	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid OTP"})
-	// 	return
-	// }
+	code, deliveryOTP, err := issuer.Issue(otp.Delivery)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate delivery OTP"})
+		return
+	}
 
-	// Update the order status to In-Transit
-	update := bson.M{"$set": bson.M{"status": "In-Transit"}}
-	_, err = collection.UpdateOne(context.Background(), bson.M{"_id": order.OrderID, "storeID": merchantID}, update)
+	order, err = orders.Transition(context.Background(), order.OrderID, repository.Scope{},
+		lifecycle.Transition{To: lifecycle.InTransit, By: lifecycle.Merchant, ActorID: uint(merchantID), Set: bson.M{"pickupOTP": nil, "deliveryOTP": deliveryOTP}})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+		respondTransitionError(c, err, "Order not found or does not belong to the merchant")
 		return
 	}
 
-	// Send OTP to customer (you need to implement this part)
+	// Send OTP to customer
+	notifier.SendOTP(notification.EventDeliveryOTP, order, code)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Pickup verified successfully"})
 }
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAdjustItems(t *testing.T) {
+	tea := primitive.NewObjectID()
+	cake := primitive.NewObjectID()
+	other := primitive.NewObjectID()
+
+	tests := []struct {
+		name       string
+		quantities map[primitive.ObjectID]int
+		wantErr    bool
+		wantTotal  float64
+		wantItems  int
+	}{
+		{name: "reduce", quantities: map[primitive.ObjectID]int{tea: 1}, wantTotal: 12.5, wantItems: 2},
+		{name: "remove", quantities: map[primitive.ObjectID]int{cake: 0}, wantTotal: 5, wantItems: 1},
+		{name: "reduce and remove", quantities: map[primitive.ObjectID]int{tea: 1, cake: 0}, wantTotal: 2.5, wantItems: 1},
+		{name: "negative", quantities: map[primitive.ObjectID]int{tea: -3}, wantErr: true},
+		{name: "same quantity", quantities: map[primitive.ObjectID]int{tea: 2}, wantErr: true},
+		{name: "increase", quantities: map[primitive.ObjectID]int{cake: 2}, wantErr: true},
+		{name: "not in order", quantities: map[primitive.ObjectID]int{other: 0}, wantErr: true},
+		{name: "nothing left", quantities: map[primitive.ObjectID]int{tea: 0, cake: 0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{
+				Items: []models.OrderItem{
+					{ItemID: tea, Name: "Tea", Quantity: 2, Price: 2.5, LineTotal: 5},
+					{ItemID: cake, Name: "Cake", Quantity: 1, Price: 10, LineTotal: 10},
+				},
+				TotalAmount: 15,
+			}
+
+			adjusted, err := adjustItems(&order, tt.quantities)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("adjustItems succeeded with total %.2f, want an error", order.TotalAmount)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("adjustItems: %v", err)
+			}
+
+			if len(adjusted) != len(tt.quantities) {
+				t.Errorf("got %d adjusted items, want %d", len(adjusted), len(tt.quantities))
+			}
+			if len(order.Items) != tt.wantItems {
+				t.Errorf("got %d items left, want %d", len(order.Items), tt.wantItems)
+			}
+			if order.TotalAmount != tt.wantTotal {
+				t.Errorf("got total %.2f, want %.2f", order.TotalAmount, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/notification"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// checkOTP verifies code against the OTP stored on the order for purpose and
+// writes the error response when it does not match. Every attempt is counted
+// towards the lockout before the code is compared.
+func checkOTP(c *gin.Context, orders repository.OrderRepository, issuer *otp.Issuer, order models.Order, purpose, code string) bool {
+	stored, err := orders.AttemptOTP(context.Background(), order.OrderID, purpose, issuer.MaxAttempts())
+	if err == nil {
+		err = issuer.Check(purpose, &stored, code)
+	}
+
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, otp.ErrInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid OTP"})
+	case errors.Is(err, otp.ErrLocked):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error() + ", request a new OTP"})
+	case errors.Is(err, otp.ErrExpired):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error() + ", request a new OTP"})
+	case errors.Is(err, otp.ErrMissing):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify OTP"})
+	}
+	return false
+}
+
+// reissueOTP replaces the OTP for purpose on an order within scope that is
+// in the given status, sends the new code and writes the JSON response. The
+// new OTP starts with no failed attempts.
+func reissueOTP(c *gin.Context, orders repository.OrderRepository, issuer *otp.Issuer, notifier *notification.Dispatcher, orderID primitive.ObjectID, scope repository.Scope, status, purpose, event, notFound string) {
+	code, record, err := issuer.Issue(purpose)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate OTP"})
+		return
+	}
+
+	order, err := orders.ReplaceOTP(context.Background(), orderID, scope, status, purpose, record)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store OTP"})
+		return
+	}
+
+	notifier.SendOTP(event, order, code)
+
+	c.JSON(http.StatusOK, gin.H{"message": "A new OTP has been sent"})
+}
+
+// ReissuePickupOTP handles the endpoint for a delivery agent getting a new
+// pickup OTP after the old one expired or locked.
+func ReissuePickupOTP(c *gin.Context, orders repository.OrderRepository, issuer *otp.Issuer, notifier *notification.Dispatcher, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	deliveryAgentID := models.AgentID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	reissueOTP(c, orders, issuer, notifier, orderID, repository.Agent(deliveryAgentID), lifecycle.Assigned, otp.Pickup, notification.EventPickupOTP,
+		"Order not found, not awaiting pickup or does not belong to the delivery agent")
+}
+
+// ReissueDeliveryOTP handles the endpoint for a customer getting a new
+// delivery OTP after the old one expired or locked.
+func ReissueDeliveryOTP(c *gin.Context, orders repository.OrderRepository, issuer *otp.Issuer, notifier *notification.Dispatcher, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	reissueOTP(c, orders, issuer, notifier, orderID, repository.User(userID), lifecycle.InTransit, otp.Delivery, notification.EventDeliveryOTP,
+		"Order not found, not out for delivery or does not belong to the user")
+}
+
+// bindOTP reads the OTP from the request body.
+func bindOTP(c *gin.Context) (string, bool) {
+	var body struct {
+		OTP string `json:"otp" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "An OTP is required"})
+		return "", false
+	}
+	return body.OTP, true
+}
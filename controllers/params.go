@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// objectIDParam parses a hex ObjectID path parameter and writes a 400
+// response when it is malformed.
+func objectIDParam(c *gin.Context, name, label string) (primitive.ObjectID, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param(name))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + label + " ID"})
+		return id, false
+	}
+	return id, true
+}
+
+// orderIDParam parses the :orderID path parameter.
+func orderIDParam(c *gin.Context) (primitive.ObjectID, bool) {
+	return objectIDParam(c, "orderID", "order")
+}
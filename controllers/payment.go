@@ -0,0 +1,353 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PayOrder handles the endpoint that serves the checkout page for a pending order.
+func PayOrder(c *gin.Context, orders repository.OrderRepository, gateway payment.Gateway, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	order, err := orders.Get(context.Background(), orderID, repository.User(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the user"})
+		return
+	}
+
+	if order.Status != lifecycle.PendingPayment {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Order is not awaiting payment"})
+		return
+	}
+
+	c.Render(http.StatusOK, render.HTML{
+		Template: payment.CheckoutPage,
+		Data: payment.CheckoutData{
+			KeyID:          gateway.KeyID(),
+			GatewayOrderID: order.Payment.GatewayOrderID,
+			Amount:         order.Payment.Amount,
+			Display:        strconv.FormatFloat(order.TotalAmount, 'f', 2, 64),
+			Currency:       order.Payment.Currency,
+			SuccessURL:     c.Request.URL.Path + "/success",
+			FailureURL:     c.Request.URL.Path + "/failure",
+		},
+	})
+}
+
+// PaymentSuccess handles the checkout callback for a completed payment. The
+// order is only marked as paid when the gateway signature is valid.
+func PaymentSuccess(c *gin.Context, orders repository.OrderRepository, gateway payment.Gateway, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		PaymentID string `json:"paymentID" binding:"required"`
+		Signature string `json:"signature" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	order, err := orders.Get(context.Background(), orderID, repository.User(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the user"})
+		return
+	}
+
+	// The signature covers our gateway order, so a payment for another order is rejected
+	if err := gateway.VerifyPaymentSignature(order.Payment.GatewayOrderID, body.PaymentID, body.Signature); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payment signature"})
+		return
+	}
+
+	_, err = orders.Transition(context.Background(), order.OrderID, repository.Scope{}, paidTransition(body.PaymentID))
+	if errors.Is(err, lifecycle.ErrIllegalTransition) {
+		// The webhook usually confirms the payment first. Otherwise the order
+		// was cancelled while the checkout was open and the payment goes back.
+		current, getErr := orders.Get(context.Background(), order.OrderID, repository.Scope{})
+		if getErr != nil {
+			respondTransitionError(c, getErr, "Order not found or does not belong to the user")
+			return
+		}
+		if current.Payment.Status == payment.StatusPaid && current.Payment.PaymentID == body.PaymentID {
+			c.JSON(http.StatusOK, gin.H{"message": "Payment confirmed successfully"})
+			return
+		}
+
+		entity := payment.PaymentEntity{ID: body.PaymentID, OrderID: current.Payment.GatewayOrderID}
+		if err := refundStrayCapture(context.Background(), orders, gateway, current, entity); err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Order can no longer be paid and the payment could not be refunded"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Order can no longer be paid, the payment has been refunded"})
+		return
+	}
+	if err != nil {
+		respondTransitionError(c, err, "Order not found or does not belong to the user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment confirmed successfully"})
+}
+
+// PaymentFailure handles the checkout callback for a failed payment. The order
+// stays pending so the customer can try again.
+func PaymentFailure(c *gin.Context, orders repository.OrderRepository, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		PaymentID string `json:"paymentID"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	// An order only awaits payment once its gateway order is stored
+	order, err := orders.Get(context.Background(), orderID, repository.User(userID))
+	if err != nil || order.Payment.GatewayOrderID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or is not awaiting payment"})
+		return
+	}
+
+	matched, err := orders.MarkPaymentFailed(context.Background(), order.Payment.GatewayOrderID, body.PaymentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record payment failure"})
+		return
+	}
+	if !matched {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or is not awaiting payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Payment failure recorded"})
+}
+
+// PaymentWebhook handles server to server notifications from the payment
+// provider. Each provider event is applied at most once.
+func PaymentWebhook(c *gin.Context, orders repository.OrderRepository, events repository.WebhookEventRepository, gateway payment.Gateway) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	if err := gateway.VerifyWebhookSignature(body, c.GetHeader("X-Razorpay-Signature")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook signature"})
+		return
+	}
+
+	eventID := c.GetHeader("X-Razorpay-Event-Id")
+	if eventID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing webhook event ID"})
+		return
+	}
+
+	var event payment.WebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+		return
+	}
+
+	first, err := events.Claim(context.Background(), eventID, event.Event)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		return
+	}
+	if !first {
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook already processed"})
+		return
+	}
+
+	if err := applyWebhookEvent(context.Background(), orders, gateway, event); err != nil {
+		// Let the provider retry the event later
+		_ = events.Release(context.Background(), eventID)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook processed"})
+}
+
+// applyWebhookEvent drives the order change for a provider event. Events for
+// unknown orders are ignored. A payment captured for an order that can no
+// longer be paid is refunded.
+func applyWebhookEvent(ctx context.Context, orders repository.OrderRepository, gateway payment.Gateway, event payment.WebhookEvent) error {
+	var err error
+	switch event.Event {
+	case payment.EventPaymentCaptured:
+		entity := event.Payload.Payment.Entity
+		var order models.Order
+		order, err = orders.GetByGatewayOrder(ctx, entity.OrderID)
+		if err == nil {
+			order, err = orders.Transition(ctx, order.OrderID, repository.Scope{}, paidTransition(entity.ID))
+			if errors.Is(err, lifecycle.ErrIllegalTransition) {
+				err = refundStrayCapture(ctx, orders, gateway, order, entity)
+			}
+		}
+	case payment.EventPaymentFailed:
+		entity := event.Payload.Payment.Entity
+		_, err = orders.MarkPaymentFailed(ctx, entity.OrderID, entity.ID)
+	case payment.EventRefundProcessed:
+		err = orders.SetRefundStatus(ctx, event.Payload.Refund.Entity.ID, payment.RefundProcessed)
+	case payment.EventRefundFailed:
+		err = orders.SetRefundStatus(ctx, event.Payload.Refund.Entity.ID, payment.RefundFailed)
+	}
+
+	if errors.Is(err, repository.ErrNotFound) || errors.Is(err, lifecycle.ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// refundStrayCapture returns a payment captured for an order that is past
+// PendingPayment, such as one the customer cancelled while the checkout was
+// still open. A repeated capture of the payment the order was paid with, or
+// of a payment already refunded, is ignored. A refund the gateway rejects is
+// returned as an error so the provider delivers the event again.
+func refundStrayCapture(ctx context.Context, orders repository.OrderRepository, gateway payment.Gateway, order models.Order, entity payment.PaymentEntity) error {
+	if order.Payment.Status == payment.StatusPaid && order.Payment.PaymentID == entity.ID {
+		return nil
+	}
+	for _, refund := range order.Refunds {
+		if refund.PaymentID == entity.ID {
+			return nil
+		}
+	}
+
+	amount := entity.Amount
+	if amount <= 0 {
+		amount = order.Payment.Amount
+	}
+
+	issued, err := gateway.Refund(ctx, entity.ID, amount)
+	if err != nil {
+		log.Printf("payment: failed to refund payment %s captured for order %s in status %s: %v", entity.ID, order.OrderID.Hex(), order.Status, err)
+		return err
+	}
+
+	now := time.Now().UTC()
+	return orders.AddRefund(ctx, order.OrderID, models.Refund{
+		ID:        primitive.NewObjectID(),
+		RefundID:  issued.ID,
+		PaymentID: entity.ID,
+		Amount:    amount,
+		Status:    issued.Status,
+		Reason:    "Payment captured after the order was " + order.Status,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+}
+
+// paidTransition moves an order to Paid and records the gateway payment.
+func paidTransition(paymentID string) lifecycle.Transition {
+	return lifecycle.Transition{
+		To: lifecycle.Paid,
+		By: lifecycle.System,
+		Set: bson.M{
+			"payment.status":    payment.StatusPaid,
+			"payment.paymentID": paymentID,
+		},
+	}
+}
+
+// refundOrder returns amount of the order payment to the customer and records
+// the refund, and any fee withheld, on the order. A refund the gateway rejects
+// is recorded as failed for an admin to retry.
+func refundOrder(ctx context.Context, orders repository.OrderRepository, gateway payment.Gateway, order models.Order, amount, fee int64, reason string) (models.Refund, error) {
+	now := time.Now().UTC()
+	refund := models.Refund{
+		ID:        primitive.NewObjectID(),
+		Amount:    amount,
+		Fee:       fee,
+		Status:    payment.RefundFailed,
+		Reason:    reason,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	issued, err := gateway.Refund(ctx, order.Payment.PaymentID, amount)
+	if err != nil {
+		log.Printf("payment: failed to refund %d of payment %s for order %s, recorded as refund %s: %v", amount, order.Payment.PaymentID, order.OrderID.Hex(), refund.ID.Hex(), err)
+	} else {
+		refund.RefundID = issued.ID
+		refund.Status = issued.Status
+	}
+
+	if err := orders.AddRefund(ctx, order.OrderID, refund); err != nil {
+		return refund, err
+	}
+	return refund, nil
+}
+
+// startPayment creates the gateway order that collects the order total.
+func startPayment(ctx context.Context, gateway payment.Gateway, order *models.Order) error {
+	amount := payment.Subunits(order.TotalAmount)
+	if amount <= 0 {
+		return errors.New("order total must be positive")
+	}
+
+	gatewayOrder, err := gateway.CreateOrder(ctx, amount, order.OrderID.Hex())
+	if err != nil {
+		return err
+	}
+
+	order.Payment = models.PaymentInfo{
+		GatewayOrderID: gatewayOrder.ID,
+		Amount:         gatewayOrder.Amount,
+		Currency:       gatewayOrder.Currency,
+		Status:         payment.StatusCreated,
+	}
+	return nil
+}
+
+// respondOrderPlaced returns what the client needs to collect payment for a new order.
+func respondOrderPlaced(c *gin.Context, gateway payment.Gateway, order models.Order) {
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Order placed successfully",
+		"id":      order.OrderID,
+		"status":  order.Status,
+		"payment": gin.H{
+			"keyID":          gateway.KeyID(),
+			"gatewayOrderID": order.Payment.GatewayOrderID,
+			"amount":         order.Payment.Amount,
+			"currency":       order.Payment.Currency,
+		},
+	})
+}
@@ -0,0 +1,384 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testGateway is the fake gateway with orders and refunds that can be made
+// to fail, and that counts the orders and refunds it issued.
+type testGateway struct {
+	*payment.Fake
+
+	mu          sync.Mutex
+	failOrders  bool
+	failRefunds bool
+	orders      int
+	refunds     int
+}
+
+func (g *testGateway) CreateOrder(ctx context.Context, amount int64, receipt string) (payment.Order, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failOrders {
+		return payment.Order{}, errors.New("gateway unavailable")
+	}
+	g.orders++
+	return g.Fake.CreateOrder(ctx, amount, receipt)
+}
+
+func newTestGateway(t *testing.T) *testGateway {
+	fake, err := payment.NewFake()
+	if err != nil {
+		t.Fatalf("NewFake: %v", err)
+	}
+	return &testGateway{Fake: fake}
+}
+
+func (g *testGateway) Refund(ctx context.Context, paymentID string, amount int64) (payment.Refund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.failRefunds {
+		return payment.Refund{}, errors.New("gateway unavailable")
+	}
+	g.refunds++
+	return g.Fake.Refund(ctx, paymentID, amount)
+}
+
+func (g *testGateway) setFailRefunds(fail bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failRefunds = fail
+}
+
+// paidOrder stores an order in the given status that was paid with pay_1.
+func paidOrder(t *testing.T, orders *repository.MemoryOrders, status string) models.Order {
+	order := models.Order{
+		OrderID:   primitive.NewObjectID(),
+		StoreID:   models.NewStoreID(),
+		UserID:    1,
+		Status:    status,
+		Refunds:   []models.Refund{},
+		CreatedAt: time.Now().UTC(),
+		Payment: models.PaymentInfo{
+			GatewayOrderID: "order_" + primitive.NewObjectID().Hex(),
+			PaymentID:      "pay_1",
+			Amount:         500,
+			Currency:       payment.Currency,
+			Status:         payment.StatusPaid,
+		},
+	}
+	return storeOrder(t, orders, order)
+}
+
+// pendingOrder stores an order waiting for its payment.
+func pendingOrder(t *testing.T, orders *repository.MemoryOrders) models.Order {
+	order := models.Order{
+		OrderID:   primitive.NewObjectID(),
+		StoreID:   models.NewStoreID(),
+		UserID:    1,
+		Status:    lifecycle.PendingPayment,
+		Refunds:   []models.Refund{},
+		CreatedAt: time.Now().UTC(),
+		Payment: models.PaymentInfo{
+			GatewayOrderID: "order_" + primitive.NewObjectID().Hex(),
+			Amount:         500,
+			Currency:       payment.Currency,
+			Status:         payment.StatusCreated,
+		},
+	}
+	return storeOrder(t, orders, order)
+}
+
+func storeOrder(t *testing.T, orders *repository.MemoryOrders, order models.Order) models.Order {
+	if err := orders.Insert(context.Background(), order); err != nil {
+		t.Fatalf("insert order: %v", err)
+	}
+	return order
+}
+
+func TestFailedRefundCanBeRetried(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	orders := repository.NewMemoryOrders()
+	gateway := newTestGateway(t)
+	order := paidOrder(t, orders, lifecycle.Cancelled)
+
+	gateway.setFailRefunds(true)
+	refund, err := refundOrder(context.Background(), orders, gateway, order, 400, 100, "Order cancelled")
+	if err != nil {
+		t.Fatalf("refundOrder: %v", err)
+	}
+	if refund.ID.IsZero() || refund.Status != payment.RefundFailed {
+		t.Fatalf("refund = %+v, want a failed refund with an ID", refund)
+	}
+
+	router := gin.New()
+	router.GET("/refunds/failed", func(c *gin.Context) { GetFailedRefunds(c, orders) })
+	router.POST("/refunds/:orderID/:refundID/retry", func(c *gin.Context) { RetryRefund(c, orders, gateway) })
+	retry := func() int {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/refunds/"+order.OrderID.Hex()+"/"+refund.ID.Hex()+"/retry", nil))
+		return rec.Code
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/refunds/failed", nil))
+	if rec.Code != http.StatusOK || !containsOrder(t, rec, order.OrderID) {
+		t.Errorf("failed refunds got %d: %s, want the order listed", rec.Code, rec.Body)
+	}
+
+	// The gateway is still down, so the refund stays failed
+	if code := retry(); code != http.StatusBadGateway {
+		t.Errorf("retry while the gateway is down got %d, want %d", code, http.StatusBadGateway)
+	}
+
+	gateway.setFailRefunds(false)
+	if code := retry(); code != http.StatusOK {
+		t.Fatalf("retry got %d, want %d", code, http.StatusOK)
+	}
+	if code := retry(); code != http.StatusConflict {
+		t.Errorf("second retry got %d, want %d", code, http.StatusConflict)
+	}
+
+	stored, _ := orders.Get(context.Background(), order.OrderID, repository.Scope{})
+	if got := stored.Refunds[0]; got.Status != payment.RefundProcessed || got.RefundID == "" || got.Amount != 400 {
+		t.Errorf("refund after retry = %+v, want a processed refund of 400", got)
+	}
+	if gateway.refunds != 1 {
+		t.Errorf("gateway issued %d refunds, want 1", gateway.refunds)
+	}
+	if failed, _ := orders.ListFailedRefunds(context.Background()); len(failed) != 0 {
+		t.Errorf("%d orders still have failed refunds", len(failed))
+	}
+}
+
+func containsOrder(t *testing.T, rec *httptest.ResponseRecorder, id primitive.ObjectID) bool {
+	var orders []models.Order
+	if err := json.Unmarshal(rec.Body.Bytes(), &orders); err != nil {
+		t.Fatalf("decode orders: %v", err)
+	}
+	for _, order := range orders {
+		if order.OrderID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// flakyOrders fails the next lookups by gateway order, as if the database
+// were briefly unavailable.
+type flakyOrders struct {
+	*repository.MemoryOrders
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (r *flakyOrders) GetByGatewayOrder(ctx context.Context, gatewayOrderID string) (models.Order, error) {
+	r.mu.Lock()
+	fail := r.failures > 0
+	if fail {
+		r.failures--
+	}
+	r.mu.Unlock()
+	if fail {
+		return models.Order{}, errors.New("database unavailable")
+	}
+	return r.MemoryOrders.GetByGatewayOrder(ctx, gatewayOrderID)
+}
+
+// webhookServer serves PaymentWebhook with the memory repositories.
+type webhookServer struct {
+	t       *testing.T
+	router  *gin.Engine
+	orders  *flakyOrders
+	gateway *testGateway
+}
+
+func newWebhookServer(t *testing.T) *webhookServer {
+	gin.SetMode(gin.TestMode)
+	s := &webhookServer{
+		t:       t,
+		orders:  &flakyOrders{MemoryOrders: repository.NewMemoryOrders()},
+		gateway: newTestGateway(t),
+		router:  gin.New(),
+	}
+	events := repository.NewMemoryWebhookEvents()
+	s.router.POST("/webhook", func(c *gin.Context) { PaymentWebhook(c, s.orders, events, s.gateway) })
+	return s
+}
+
+// deliver sends body as a webhook event with the given ID and signature.
+func (s *webhookServer) deliver(eventID string, body []byte, signature string) int {
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("X-Razorpay-Event-Id", eventID)
+	req.Header.Set("X-Razorpay-Signature", signature)
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// capture delivers a signed payment.captured event for the order.
+func (s *webhookServer) capture(eventID string, order models.Order, paymentID string) int {
+	body := capturedEvent(s.t, order, paymentID)
+	return s.deliver(eventID, body, s.gateway.SignWebhook(body))
+}
+
+func capturedEvent(t *testing.T, order models.Order, paymentID string) []byte {
+	var event payment.WebhookEvent
+	event.Event = payment.EventPaymentCaptured
+	event.Payload.Payment.Entity = payment.PaymentEntity{
+		ID:      paymentID,
+		OrderID: order.Payment.GatewayOrderID,
+		Amount:  order.Payment.Amount,
+		Status:  "captured",
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+	return body
+}
+
+func (s *webhookServer) get(order models.Order) models.Order {
+	stored, err := s.orders.Get(context.Background(), order.OrderID, repository.Scope{})
+	if err != nil {
+		s.t.Fatalf("order: %v", err)
+	}
+	return stored
+}
+
+func TestWebhookAppliesEachEventOnce(t *testing.T) {
+	s := newWebhookServer(t)
+	order := pendingOrder(t, s.orders.MemoryOrders)
+
+	for i := 0; i < 2; i++ {
+		if code := s.capture("evt_1", order, "pay_1"); code != http.StatusOK {
+			t.Fatalf("delivery %d got %d", i+1, code)
+		}
+	}
+
+	paid := s.get(order)
+	if paid.Status != lifecycle.Paid || paid.Payment.PaymentID != "pay_1" {
+		t.Errorf("order is %s paid with %q, want Paid with pay_1", paid.Status, paid.Payment.PaymentID)
+	}
+	transitions := 0
+	for _, change := range paid.History {
+		if change.To == lifecycle.Paid {
+			transitions++
+		}
+	}
+	if transitions != 1 || len(paid.Refunds) != 0 {
+		t.Errorf("order moved to Paid %d times with refunds %+v, want once without refunds", transitions, paid.Refunds)
+	}
+}
+
+func TestWebhookReleasesFailedEvents(t *testing.T) {
+	s := newWebhookServer(t)
+	order := pendingOrder(t, s.orders.MemoryOrders)
+	s.orders.failures = 1
+
+	if code := s.capture("evt_1", order, "pay_1"); code != http.StatusInternalServerError {
+		t.Fatalf("failed delivery got %d, want %d", code, http.StatusInternalServerError)
+	}
+	if status := s.get(order).Status; status != lifecycle.PendingPayment {
+		t.Fatalf("order is %s after the failed delivery, want %s", status, lifecycle.PendingPayment)
+	}
+
+	// The provider retries with the same event ID
+	if code := s.capture("evt_1", order, "pay_1"); code != http.StatusOK {
+		t.Fatalf("retry got %d, want %d", code, http.StatusOK)
+	}
+	if status := s.get(order).Status; status != lifecycle.Paid {
+		t.Errorf("order is %s after the retry, want %s", status, lifecycle.Paid)
+	}
+}
+
+func TestWebhookRejectsBadSignatures(t *testing.T) {
+	s := newWebhookServer(t)
+	order := pendingOrder(t, s.orders.MemoryOrders)
+	body := capturedEvent(t, order, "pay_1")
+
+	// The HMAC anyone can compute when the secret is empty
+	mac := hmac.New(sha256.New, nil)
+	mac.Write(body)
+	emptyKey := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		signature string
+	}{
+		{"missing", ""},
+		{"not hex", "signature"},
+		{"other body", s.gateway.SignWebhook([]byte("{}"))},
+		{"empty key", emptyKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := s.deliver("evt_"+tt.name, body, tt.signature); code != http.StatusBadRequest {
+				t.Errorf("got %d, want %d", code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	// A gateway without a webhook secret accepts nothing
+	events := repository.NewMemoryWebhookEvents()
+	router := gin.New()
+	router.POST("/webhook", func(c *gin.Context) { PaymentWebhook(c, s.orders, events, &payment.Razorpay{}) })
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	req.Header.Set("X-Razorpay-Event-Id", "evt_unsigned")
+	req.Header.Set("X-Razorpay-Signature", emptyKey)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("empty webhook secret got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	if status := s.get(order).Status; status != lifecycle.PendingPayment {
+		t.Errorf("order is %s, want %s", status, lifecycle.PendingPayment)
+	}
+}
+
+func TestWebhookRefundsCaptureForCancelledOrder(t *testing.T) {
+	s := newWebhookServer(t)
+	order := pendingOrder(t, s.orders.MemoryOrders)
+	if _, err := s.orders.Transition(context.Background(), order.OrderID, repository.Scope{},
+		lifecycle.Transition{To: lifecycle.Cancelled, By: lifecycle.Customer, ActorID: 1}); err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+
+	// The same capture is delivered twice, and once more under a new event ID
+	for _, eventID := range []string{"evt_1", "evt_1", "evt_2"} {
+		if code := s.capture(eventID, order, "pay_1"); code != http.StatusOK {
+			t.Fatalf("delivery of %s got %d", eventID, code)
+		}
+	}
+
+	cancelled := s.get(order)
+	if cancelled.Status != lifecycle.Cancelled {
+		t.Errorf("order is %s, want %s", cancelled.Status, lifecycle.Cancelled)
+	}
+	if s.gateway.refunds != 1 || len(cancelled.Refunds) != 1 {
+		t.Fatalf("gateway issued %d refunds and the order records %d, want 1", s.gateway.refunds, len(cancelled.Refunds))
+	}
+	if refund := cancelled.Refunds[0]; refund.PaymentID != "pay_1" || refund.Amount != order.Payment.Amount {
+		t.Errorf("refund = %+v, want the full payment of pay_1", refund)
+	}
+}
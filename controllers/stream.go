@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/events"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+)
+
+// keepAliveInterval is how often an idle stream sends a ping so proxies do
+// not close it.
+const keepAliveInterval = 15 * time.Second
+
+// StreamOrder handles the endpoint for following an order as Server-Sent
+// Events. The current status and agent position are sent first, then every
+// status change and position update until the order is delivered or
+// cancelled. The stream ends early if the client falls too far behind; it
+// gets the current state again when it reconnects.
+func StreamOrder(c *gin.Context, orders repository.OrderRepository, hub *events.Hub, storeSession *sessions.FilesystemStore) {
+	session, _ := storeSession.Get(c.Request, "session-name")
+	accountID, _ := session.Values["user_id"].(uint)
+	userID := models.UserID(accountID)
+
+	orderID, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	order, err := orders.Get(context.Background(), orderID, repository.User(userID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found or does not belong to the user"})
+		return
+	}
+
+	updates, unsubscribe := hub.Subscribe(c.Request.Context(), order.OrderID)
+	defer unsubscribe()
+
+	// Read the order again now that we are subscribed, so no change made in
+	// between is missed
+	order, err = orders.Get(context.Background(), order.OrderID, repository.Scope{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve order"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	snapshot := events.StatusUpdate{Status: order.Status}
+	if n := len(order.History); n > 0 {
+		snapshot.Change = &order.History[n-1]
+	}
+	c.SSEvent(events.Status, snapshot)
+	if order.DeliveryInfo.LastLocation != nil {
+		c.SSEvent(events.Location, order.DeliveryInfo.LastLocation)
+	}
+	c.Writer.Flush()
+	if lifecycle.Final(order.Status) {
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-updates:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Name, event.Data)
+			update, isStatus := event.Data.(events.StatusUpdate)
+			return !isStatus || !lifecycle.Final(update.Status)
+		case <-keepAlive.C:
+			c.SSEvent("ping", time.Now().UTC())
+			return true
+		}
+	})
+}
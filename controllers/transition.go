@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// transitionOrder moves the order with the given ID within scope through the
+// lifecycle and writes the JSON response for the outcome.
+func transitionOrder(c *gin.Context, orders repository.OrderRepository, orderID primitive.ObjectID, scope repository.Scope, t lifecycle.Transition, notFound, success string) {
+	_, err := orders.Transition(context.Background(), orderID, scope, t)
+	if err != nil {
+		respondTransitionError(c, err, notFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": success})
+}
+
+// respondTransitionError maps lifecycle errors onto HTTP responses.
+func respondTransitionError(c *gin.Context, err error, notFound string) {
+	switch {
+	case errors.Is(err, lifecycle.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case errors.Is(err, lifecycle.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Order was updated by another request, please retry"})
+	case errors.Is(err, lifecycle.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.ErrIllegalTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, lifecycle.ErrUnknownStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update order status"})
+	}
+}
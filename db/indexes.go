@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Server error codes returned when an index already exists with other options.
+const (
+	indexOptionsConflict  = 85
+	indexKeySpecsConflict = 86
+)
+
+const cartTTLIndex = "updatedAt_ttl"
+
+// EnsureCartIndexes creates the TTL index that expires carts which have not
+// been touched for ttl. An existing index is updated to the new TTL.
+func EnsureCartIndexes(ctx context.Context, carts *mongo.Collection, ttl time.Duration) error {
+	seconds := int32(ttl.Seconds())
+
+	_, err := carts.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "updatedAt", Value: 1}},
+		Options: options.Index().SetName(cartTTLIndex).SetExpireAfterSeconds(seconds),
+	})
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == indexOptionsConflict || cmdErr.Code == indexKeySpecsConflict) {
+		// The TTL changed since the index was created
+		return carts.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: carts.Name()},
+			{Key: "index", Value: bson.M{"name": cartTTLIndex, "expireAfterSeconds": seconds}},
+		}).Err()
+	}
+	return err
+}
+
+// EnsureTrailIndexes creates the indexes on the delivery location trail: a
+// 2dsphere index for geo queries and one for reading an order's trail in time
+// order.
+func EnsureTrailIndexes(ctx context.Context, trail *mongo.Collection) error {
+	_, err := trail.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "point", Value: "2dsphere"}}},
+		{Keys: bson.D{{Key: "orderID", Value: 1}, {Key: "recordedAt", Value: 1}}},
+	})
+	return err
+}
+
+// EnsureMerchantEventIndexes creates the unique index that gives every
+// merchant board event its own sequence number within a store.
+func EnsureMerchantEventIndexes(ctx context.Context, events *mongo.Collection) error {
+	_, err := events.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "storeID", Value: 1}, {Key: "seq", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// EnsureStoreIndexes makes sure a merchant runs at most one store.
+func EnsureStoreIndexes(ctx context.Context, stores *mongo.Collection) error {
+	_, err := stores.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "merchantID", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
@@ -0,0 +1,147 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+)
+
+// MaxCapacity is the most orders an agent may carry at once.
+const MaxCapacity = 10
+
+// claimLease bounds how long accepting an order holds the agent's claim, in
+// case the process dies before giving it back.
+const claimLease = 10 * time.Second
+
+var (
+	ErrAgentUnavailable = errors.New("delivery agent is offline or at capacity")
+	ErrClaimInProgress  = errors.New("delivery agent is already accepting another order")
+	ErrInvalidCapacity  = errors.New("capacity must be between 1 and 10")
+)
+
+// Agents tracks which delivery agents are on shift and how many orders they
+// are carrying. The load is counted from the orders themselves, so it cannot
+// drift when an update is lost.
+type Agents struct {
+	agents          repository.AgentRepository
+	orders          repository.OrderRepository
+	defaultCapacity int
+}
+
+func NewAgents(agents repository.AgentRepository, orders repository.OrderRepository, defaultCapacity int) *Agents {
+	return &Agents{agents: agents, orders: orders, defaultCapacity: defaultCapacity}
+}
+
+// Get returns the agent's availability. Agents that never went online are
+// reported as offline.
+func (a *Agents) Get(ctx context.Context, agentID models.AgentID) (models.Agent, error) {
+	agent, err := a.agents.Get(ctx, agentID)
+	if errors.Is(err, repository.ErrNotFound) {
+		agent = models.Agent{AgentID: agentID, Capacity: a.defaultCapacity}
+	} else if err != nil {
+		return agent, err
+	}
+	return a.withActive(ctx, agent)
+}
+
+// withActive fills in how many orders the agent is carrying.
+func (a *Agents) withActive(ctx context.Context, agent models.Agent) (models.Agent, error) {
+	counts, err := a.orders.CountCarrying(ctx, agent.AgentID)
+	agent.Active = counts[agent.AgentID]
+	return agent, err
+}
+
+// GoOnline starts a shift for the agent. A capacity of zero keeps the current
+// capacity, or the default for new agents.
+func (a *Agents) GoOnline(ctx context.Context, agentID models.AgentID, capacity int) (models.Agent, error) {
+	if capacity < 0 || capacity > MaxCapacity {
+		return models.Agent{}, ErrInvalidCapacity
+	}
+
+	agent, err := a.agents.GoOnline(ctx, agentID, capacity, a.defaultCapacity, time.Now().UTC())
+	if err != nil {
+		return agent, err
+	}
+	return a.withActive(ctx, agent)
+}
+
+// GoOffline ends the agent's shift. Orders already accepted stay with the
+// agent, but no new ones are offered.
+func (a *Agents) GoOffline(ctx context.Context, agentID models.AgentID) (models.Agent, error) {
+	agent, err := a.agents.GoOffline(ctx, agentID, time.Now().UTC())
+	if errors.Is(err, repository.ErrNotFound) {
+		return a.Get(ctx, agentID)
+	}
+	if err != nil {
+		return agent, err
+	}
+	return a.withActive(ctx, agent)
+}
+
+// Available lists the agents that can take another order.
+func (a *Agents) Available(ctx context.Context) ([]models.Agent, error) {
+	online, err := a.agents.ListOnline(ctx)
+	if err != nil || len(online) == 0 {
+		return nil, err
+	}
+
+	ids := make([]models.AgentID, 0, len(online))
+	for _, agent := range online {
+		ids = append(ids, agent.AgentID)
+	}
+	counts, err := a.orders.CountCarrying(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	var agents []models.Agent
+	for _, agent := range online {
+		agent.Active = counts[agent.AgentID]
+		if agent.Active < agent.Capacity {
+			agents = append(agents, agent)
+		}
+	}
+	return agents, nil
+}
+
+// Hold reserves the agent for accepting one order. It fails unless the agent
+// is online and under capacity, and only one accept per agent runs at a time
+// so parallel accepts cannot go over capacity. The returned function gives
+// the hold back.
+func (a *Agents) Hold(ctx context.Context, agentID models.AgentID) (func(), error) {
+	now := time.Now().UTC()
+	err := a.agents.Hold(ctx, agentID, now, now.Add(claimLease))
+	if errors.Is(err, repository.ErrNotFound) {
+		current, err := a.Get(ctx, agentID)
+		if err == nil && current.Online {
+			return nil, ErrClaimInProgress
+		}
+		return nil, ErrAgentUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := a.agents.Unhold(ctx, agentID); err != nil {
+			log.Printf("dispatch: failed to release the claim of agent %d: %v", agentID, err)
+		}
+	}
+
+	agent, err := a.Get(ctx, agentID)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if agent.Active >= agent.Capacity {
+		release()
+		return nil, ErrAgentUnavailable
+	}
+	return release, nil
+}
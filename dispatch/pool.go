@@ -0,0 +1,99 @@
+package dispatch
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/notification"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// agentField is the order field holding the assigned delivery agent.
+const agentField = "deliveryInfo.deliveryAgentID"
+
+// Pool is the set of orders that are ready for pickup and waiting for a
+// delivery agent. Orders are only offered to agents who are online and under
+// capacity, and the first agent to claim an order gets it.
+type Pool struct {
+	orders   repository.OrderRepository
+	agents   *Agents
+	notifier *notification.Dispatcher
+}
+
+func NewPool(orders repository.OrderRepository, agents *Agents, notifier *notification.Dispatcher) *Pool {
+	return &Pool{orders: orders, agents: agents, notifier: notifier}
+}
+
+// OffersFor lists the open orders offered to an agent, which is none unless
+// the agent is online and under capacity.
+func (p *Pool) OffersFor(ctx context.Context, agentID models.AgentID) ([]models.Order, error) {
+	agent, err := p.agents.Get(ctx, agentID)
+	if err != nil {
+		return nil, err
+	}
+	if !agent.Online || agent.Active >= agent.Capacity {
+		return []models.Order{}, nil
+	}
+	return p.Open(ctx)
+}
+
+// Open lists the orders waiting for an agent, oldest first.
+func (p *Pool) Open(ctx context.Context) ([]models.Order, error) {
+	return p.orders.ListOpen(ctx)
+}
+
+// Claim assigns an open order to the agent if they are online and under
+// capacity. The status change is a compare-and-set on Ready, so when agents
+// race only the first one wins and the others get lifecycle.ErrConflict or
+// lifecycle.ErrNotFound. Set holds extra fields to store with the assignment.
+func (p *Pool) Claim(ctx context.Context, orderID primitive.ObjectID, agentID models.AgentID, set bson.M) (models.Order, error) {
+	release, err := p.agents.Hold(ctx, agentID)
+	if err != nil {
+		return models.Order{}, err
+	}
+	defer release()
+
+	fields := bson.M{agentField: agentID}
+	for field, value := range set {
+		fields[field] = value
+	}
+
+	return p.orders.Transition(ctx, orderID, repository.Unassigned(), lifecycle.Transition{
+		To:      lifecycle.Assigned,
+		By:      lifecycle.DeliveryAgent,
+		ActorID: uint(agentID),
+		Set:     fields,
+	})
+}
+
+// OrderTransitioned is a lifecycle.Listener that offers orders to available
+// delivery agents as soon as they are ready for pickup. An agent's capacity
+// frees up by itself once an order they carry is delivered or cancelled.
+func (p *Pool) OrderTransitioned(order models.Order, change models.StatusChange) {
+	if change.To == lifecycle.Ready {
+		go p.offer(order)
+	}
+}
+
+func (p *Pool) offer(order models.Order) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	agents, err := p.agents.Available(ctx)
+	if err != nil {
+		log.Printf("dispatch: failed to list available agents for order %s: %v", order.OrderID.Hex(), err)
+		return
+	}
+
+	ids := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		ids = append(ids, strconv.FormatUint(uint64(agent.AgentID), 10))
+	}
+	p.notifier.OfferOrder(order, ids...)
+}
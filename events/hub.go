@@ -0,0 +1,123 @@
+package events
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Event names, used as the SSE event type.
+const (
+	Status   = "status"
+	Location = "location"
+)
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is dropped.
+const subscriberBuffer = 16
+
+// Event is a change to an order pushed to its subscribers.
+type Event struct {
+	Name string
+	Data interface{}
+}
+
+// StatusUpdate is the data of a Status event. Change is the history entry for
+// the move, when known.
+type StatusUpdate struct {
+	Status string               `json:"status"`
+	Change *models.StatusChange `json:"change,omitempty"`
+}
+
+// Hub fans order events out to the subscribers of each order. Events are
+// published either from a MongoDB change stream, see Watch, or in process by
+// the lifecycle and tracking listeners.
+type Hub struct {
+	mu     sync.RWMutex
+	topics map[primitive.ObjectID]map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{topics: make(map[primitive.ObjectID]map[chan Event]struct{})}
+}
+
+// Subscribe returns the events for an order. The channel is closed when ctx
+// is done, when the returned function is called, or when the subscriber
+// falls more than subscriberBuffer events behind; a dropped subscriber has
+// missed events and should read the order again.
+func (h *Hub) Subscribe(ctx context.Context, orderID primitive.ObjectID) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.topics[orderID] == nil {
+		h.topics[orderID] = make(map[chan Event]struct{})
+	}
+	h.topics[orderID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			close(done)
+			h.drop(orderID, ch)
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			unsubscribe()
+		case <-done:
+		}
+	}()
+	return ch, unsubscribe
+}
+
+// Publish sends an event to every subscriber of an order without waiting on
+// any of them. Subscribers whose buffer is full are dropped.
+func (h *Hub) Publish(orderID primitive.ObjectID, event Event) {
+	var behind []chan Event
+	h.mu.RLock()
+	for ch := range h.topics[orderID] {
+		select {
+		case ch <- event:
+		default:
+			behind = append(behind, ch)
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, ch := range behind {
+		log.Printf("events: subscriber of order %s is behind, dropping it at %s event", orderID.Hex(), event.Name)
+		h.drop(orderID, ch)
+	}
+}
+
+// drop removes a subscriber and closes its channel, unless that was already
+// done. Channels are only closed under the write lock, so Publish never sends
+// on a closed channel.
+func (h *Hub) drop(orderID primitive.ObjectID, ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.topics[orderID][ch]; !ok {
+		return
+	}
+	delete(h.topics[orderID], ch)
+	if len(h.topics[orderID]) == 0 {
+		delete(h.topics, orderID)
+	}
+	close(ch)
+}
+
+// OrderTransitioned is a lifecycle.Listener that publishes status changes.
+func (h *Hub) OrderTransitioned(order models.Order, change models.StatusChange) {
+	h.Publish(order.OrderID, Event{Name: Status, Data: StatusUpdate{Status: change.To, Change: &change}})
+}
+
+// LocationRecorded is a tracking.Listener that publishes agent positions.
+func (h *Hub) LocationRecorded(orderID primitive.ObjectID, location models.Location) {
+	h.Publish(orderID, Event{Name: Location, Data: location})
+}
@@ -0,0 +1,125 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func (h *Hub) subscribers(orderID primitive.ObjectID) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.topics[orderID])
+}
+
+// closes waits for ch to be closed, skipping any events still buffered.
+func closes(t *testing.T, ch <-chan Event) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("channel was not closed")
+		}
+	}
+}
+
+func TestPublishReachesSubscribersOfTheOrder(t *testing.T) {
+	hub := NewHub()
+	orderID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+
+	first, unsubscribeFirst := hub.Subscribe(context.Background(), orderID)
+	defer unsubscribeFirst()
+	second, unsubscribeSecond := hub.Subscribe(context.Background(), orderID)
+	defer unsubscribeSecond()
+	other, unsubscribeOther := hub.Subscribe(context.Background(), otherID)
+	defer unsubscribeOther()
+
+	hub.Publish(orderID, Event{Name: Status, Data: StatusUpdate{Status: "Confirmed"}})
+
+	for _, ch := range []<-chan Event{first, second} {
+		select {
+		case event := <-ch:
+			if update, ok := event.Data.(StatusUpdate); event.Name != Status || !ok || update.Status != "Confirmed" {
+				t.Errorf("got %+v, want the Confirmed status event", event)
+			}
+		default:
+			t.Error("subscriber did not receive the event")
+		}
+	}
+	select {
+	case event := <-other:
+		t.Errorf("subscriber of another order got %+v", event)
+	default:
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	hub := NewHub()
+	orderID := primitive.NewObjectID()
+
+	slow, unsubscribeSlow := hub.Subscribe(context.Background(), orderID)
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := hub.Subscribe(context.Background(), orderID)
+	defer unsubscribeFast()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		hub.Publish(orderID, Event{Name: Location})
+		<-fast
+	}
+
+	if n := hub.subscribers(orderID); n != 1 {
+		t.Errorf("%d subscribers left, want only the one keeping up", n)
+	}
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("slow subscriber got %d events before being dropped, want %d", received, subscriberBuffer)
+	}
+
+	// The remaining subscriber still gets events, and a late unsubscribe of
+	// the dropped one is harmless
+	unsubscribeSlow()
+	hub.Publish(orderID, Event{Name: Status})
+	if event := <-fast; event.Name != Status {
+		t.Errorf("got %+v after the drop, want the status event", event)
+	}
+}
+
+func TestSubscriptionEndsWithContext(t *testing.T) {
+	hub := NewHub()
+	orderID := primitive.NewObjectID()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	updates, unsubscribe := hub.Subscribe(ctx, orderID)
+	defer unsubscribe()
+
+	cancel()
+	closes(t, updates)
+	if n := hub.subscribers(orderID); n != 0 {
+		t.Errorf("%d subscribers left after the context ended, want 0", n)
+	}
+	hub.Publish(orderID, Event{Name: Status})
+}
+
+func TestUnsubscribe(t *testing.T) {
+	hub := NewHub()
+	orderID := primitive.NewObjectID()
+
+	updates, unsubscribe := hub.Subscribe(context.Background(), orderID)
+	unsubscribe()
+	unsubscribe()
+
+	closes(t, updates)
+	if n := hub.subscribers(orderID); n != 0 {
+		t.Errorf("%d subscribers left after unsubscribing, want 0", n)
+	}
+}
@@ -0,0 +1,101 @@
+package events
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// retryDelay is how long Watch waits before reopening a failed change stream.
+const retryDelay = time.Second
+
+// orderChange is the part of a change stream event the hub needs.
+type orderChange struct {
+	FullDocument      *models.Order `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+// Watch publishes status and location changes from a change stream on the
+// orders collection, so every instance of the service sees changes made by
+// the others. It fails if the deployment does not support change streams,
+// such as a standalone server, in which case the caller should register the
+// hub's listeners instead.
+func (h *Hub) Watch(ctx context.Context, orders *mongo.Collection) error {
+	stream, err := openStream(ctx, orders, nil)
+	if err != nil {
+		return err
+	}
+	go h.watch(ctx, orders, stream)
+	return nil
+}
+
+func openStream(ctx context.Context, orders *mongo.Collection, resumeToken bson.Raw) (*mongo.ChangeStream, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"operationType": "update"}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeToken != nil {
+		opts.SetResumeAfter(resumeToken)
+	}
+	return orders.Watch(ctx, pipeline, opts)
+}
+
+func (h *Hub) watch(ctx context.Context, orders *mongo.Collection, stream *mongo.ChangeStream) {
+	for {
+		for stream.Next(ctx) {
+			var change orderChange
+			if err := stream.Decode(&change); err != nil {
+				log.Printf("events: failed to decode order change: %v", err)
+				continue
+			}
+			h.publishChange(change)
+		}
+
+		resumeToken := stream.ResumeToken()
+		err := stream.Err()
+		stream.Close(context.Background())
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("events: order change stream stopped, reopening: %v", err)
+
+		// Keep retrying until the stream can be resumed or ctx ends
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(retryDelay):
+			}
+			stream, err = openStream(ctx, orders, resumeToken)
+			if err == nil {
+				break
+			}
+			log.Printf("events: failed to reopen order change stream: %v", err)
+		}
+	}
+}
+
+// publishChange turns an update to an order into status and location events.
+func (h *Hub) publishChange(change orderChange) {
+	order := change.FullDocument
+	if order == nil {
+		return
+	}
+	fields := change.UpdateDescription.UpdatedFields
+
+	if _, ok := fields["status"]; ok {
+		update := StatusUpdate{Status: order.Status}
+		if n := len(order.History); n > 0 {
+			update.Change = &order.History[n-1]
+		}
+		h.Publish(order.OrderID, Event{Name: Status, Data: update})
+	}
+	if _, ok := fields["deliveryInfo.lastLocation"]; ok && order.DeliveryInfo.LastLocation != nil {
+		h.Publish(order.OrderID, Event{Name: Location, Data: *order.DeliveryInfo.LastLocation})
+	}
+}
@@ -0,0 +1,101 @@
+package lifecycle
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+)
+
+// Cancellation reason codes merchants and delivery agents must pick from.
+const (
+	ReasonOutOfStock          = "out_of_stock"
+	ReasonStoreClosed         = "store_closed"
+	ReasonCustomerUnreachable = "customer_unreachable"
+	ReasonAddressIssue        = "address_issue"
+	ReasonVehicleIssue        = "vehicle_issue"
+	ReasonOther               = "other"
+)
+
+var reasonCodes = map[Role][]string{
+	Merchant:      {ReasonOutOfStock, ReasonStoreClosed, ReasonOther},
+	DeliveryAgent: {ReasonCustomerUnreachable, ReasonAddressIssue, ReasonVehicleIssue, ReasonOther},
+}
+
+var ErrInvalidReasonCode = errors.New("invalid cancellation reason code")
+
+// CancellationPolicy decides when customers may cancel and what a late
+// cancellation costs them.
+type CancellationPolicy struct {
+	// CustomerStatuses are the statuses a customer may cancel from.
+	CustomerStatuses []string
+	// FeePercent of the paid amount is withheld when a customer cancels an
+	// order the merchant has already confirmed.
+	FeePercent float64
+}
+
+// DefaultCancellationPolicy lets customers cancel until the order is picked
+// up, free of charge until the merchant confirms it.
+func DefaultCancellationPolicy() CancellationPolicy {
+	return CancellationPolicy{
+		CustomerStatuses: []string{PendingPayment, Paid, Confirmed, Ready},
+		FeePercent:       10,
+	}
+}
+
+// ParseStatuses reads a comma separated list of statuses.
+func ParseStatuses(list string) ([]string, error) {
+	var statuses []string
+	for _, status := range strings.Split(list, ",") {
+		status = strings.TrimSpace(status)
+		if status == "" {
+			continue
+		}
+		if !Known(status) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownStatus, status)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ReasonCodes lists the reason codes a role may cancel with.
+func ReasonCodes(role Role) []string {
+	return reasonCodes[role]
+}
+
+// CheckReasonCode validates the reason code given by a merchant or delivery agent.
+func CheckReasonCode(role Role, code string) error {
+	for _, allowed := range reasonCodes[role] {
+		if allowed == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrInvalidReasonCode, code)
+}
+
+// Guard returns the transition guard enforcing the policy for role.
+func (p CancellationPolicy) Guard(role Role) func(order models.Order) error {
+	return func(order models.Order) error {
+		if role != Customer {
+			return nil
+		}
+		for _, status := range p.CustomerStatuses {
+			if status == order.Status {
+				return nil
+			}
+		}
+		return &TransitionError{From: order.Status, To: Cancelled, Role: role}
+	}
+}
+
+// Fee returns the cancellation fee for an order cancelled by role from the
+// given status. Amounts are in currency subunits.
+func (p CancellationPolicy) Fee(role Role, from string, amount int64) int64 {
+	if role != Customer || from == PendingPayment || from == Paid {
+		return 0
+	}
+	return int64(math.Round(float64(amount) * p.FeePercent / 100))
+}
@@ -0,0 +1,123 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+)
+
+func TestCancellationGuard(t *testing.T) {
+	policy := CancellationPolicy{CustomerStatuses: []string{PendingPayment, Paid}}
+
+	tests := []struct {
+		role    Role
+		status  string
+		allowed bool
+	}{
+		{Customer, PendingPayment, true},
+		{Customer, Paid, true},
+		{Customer, Confirmed, false},
+		{Customer, InTransit, false},
+		{Merchant, Confirmed, true},
+		{Merchant, Ready, true},
+		{DeliveryAgent, InTransit, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" from "+tt.status, func(t *testing.T) {
+			err := policy.Guard(tt.role)(models.Order{Status: tt.status})
+			if tt.allowed && err != nil {
+				t.Errorf("Guard = %v, want nil", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("Guard = %v, want ErrIllegalTransition", err)
+			}
+		})
+	}
+}
+
+func TestDefaultCancellationPolicy(t *testing.T) {
+	guard := DefaultCancellationPolicy().Guard(Customer)
+	for _, status := range []string{PendingPayment, Paid, Confirmed, Ready} {
+		if err := guard(models.Order{Status: status}); err != nil {
+			t.Errorf("customer cannot cancel from %s: %v", status, err)
+		}
+	}
+	for _, status := range []string{Assigned, InTransit, Delivered, Cancelled} {
+		if err := guard(models.Order{Status: status}); err == nil {
+			t.Errorf("customer can cancel from %s", status)
+		}
+	}
+}
+
+func TestCancellationFee(t *testing.T) {
+	policy := CancellationPolicy{FeePercent: 10}
+
+	tests := []struct {
+		role   Role
+		from   string
+		amount int64
+		fee    int64
+	}{
+		{Customer, PendingPayment, 1000, 0},
+		{Customer, Paid, 1000, 0},
+		{Customer, Confirmed, 1000, 100},
+		{Customer, Ready, 1000, 100},
+		{Customer, Confirmed, 1005, 101},
+		{Customer, Confirmed, 0, 0},
+		{Merchant, Confirmed, 1000, 0},
+		{Merchant, Ready, 1000, 0},
+		{DeliveryAgent, InTransit, 1000, 0},
+	}
+	for _, tt := range tests {
+		fee := policy.Fee(tt.role, tt.from, tt.amount)
+		if fee != tt.fee {
+			t.Errorf("Fee(%s, %s, %d) = %d, want %d", tt.role, tt.from, tt.amount, fee, tt.fee)
+		}
+		if refund := tt.amount - fee; refund < 0 || refund+fee != tt.amount {
+			t.Errorf("refund of %d after a fee of %d does not add up to %d", refund, fee, tt.amount)
+		}
+	}
+
+	if fee := (CancellationPolicy{FeePercent: 100}).Fee(Customer, Confirmed, 1000); fee != 1000 {
+		t.Errorf("full fee = %d, want 1000", fee)
+	}
+}
+
+func TestReasonCodes(t *testing.T) {
+	tests := []struct {
+		role Role
+		code string
+		ok   bool
+	}{
+		{Merchant, ReasonOutOfStock, true},
+		{Merchant, ReasonStoreClosed, true},
+		{Merchant, ReasonOther, true},
+		{Merchant, ReasonVehicleIssue, false},
+		{DeliveryAgent, ReasonCustomerUnreachable, true},
+		{DeliveryAgent, ReasonAddressIssue, true},
+		{DeliveryAgent, ReasonVehicleIssue, true},
+		{DeliveryAgent, ReasonOutOfStock, false},
+		{DeliveryAgent, "", false},
+		{Customer, ReasonOther, false},
+	}
+	for _, tt := range tests {
+		err := CheckReasonCode(tt.role, tt.code)
+		if tt.ok && err != nil {
+			t.Errorf("CheckReasonCode(%s, %q) = %v, want nil", tt.role, tt.code, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidReasonCode) {
+			t.Errorf("CheckReasonCode(%s, %q) = %v, want ErrInvalidReasonCode", tt.role, tt.code, err)
+		}
+	}
+}
+
+func TestParseStatuses(t *testing.T) {
+	statuses, err := ParseStatuses(" Paid, Confirmed ,,")
+	if err != nil || len(statuses) != 2 || statuses[0] != Paid || statuses[1] != Confirmed {
+		t.Errorf("ParseStatuses = %v, %v; want [Paid Confirmed]", statuses, err)
+	}
+	if _, err := ParseStatuses("Paid,Shipped"); !errors.Is(err, ErrUnknownStatus) {
+		t.Errorf("ParseStatuses with an unknown status = %v, want ErrUnknownStatus", err)
+	}
+}
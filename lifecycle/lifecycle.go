@@ -0,0 +1,257 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Order statuses, in the order an order normally moves through them.
+const (
+	PendingPayment = "PendingPayment"
+	Paid           = "Paid"
+	Confirmed      = "Confirmed"
+	Ready          = "Ready"
+	Assigned       = "Assigned"
+	InTransit      = "In-Transit"
+	Delivered      = "Delivered"
+	Cancelled      = "Cancelled"
+)
+
+// Role identifies who is asking for a transition. The values match the
+// user_type stored in the session, except System which the service uses for
+// changes driven by the payment gateway.
+type Role string
+
+const (
+	Customer      Role = "customer"
+	Merchant      Role = "merchant"
+	DeliveryAgent Role = "delivery_agent"
+	System        Role = "system"
+)
+
+// edges lists, for every status, the statuses it may move to and the roles
+// allowed to make that move.
+var edges = map[string]map[string][]Role{
+	PendingPayment: {Paid: {System}, Cancelled: {Customer}},
+	Paid:           {Confirmed: {Merchant}, Cancelled: {Customer, Merchant}},
+	Confirmed:      {Ready: {Merchant}, Cancelled: {Customer, Merchant}},
+	Ready:          {Assigned: {DeliveryAgent}, Cancelled: {Customer, Merchant}},
+	Assigned:       {InTransit: {Merchant}, Cancelled: {Customer, Merchant, DeliveryAgent}},
+	InTransit:      {Delivered: {DeliveryAgent}, Cancelled: {Customer, DeliveryAgent}},
+	Delivered:      {},
+	Cancelled:      {},
+}
+
+var (
+	ErrNotFound          = errors.New("order not found")
+	ErrUnknownStatus     = errors.New("unknown order status")
+	ErrIllegalTransition = errors.New("illegal order status transition")
+	ErrForbidden         = errors.New("order status transition is reserved for another role")
+	ErrConflict          = errors.New("order status changed concurrently")
+)
+
+// TransitionError is returned when a role asks for a move the state machine
+// does not allow from the order's current status.
+type TransitionError struct {
+	From string
+	To   string
+	Role Role
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("cannot move order from %s to %s as %s", e.From, e.To, e.Role)
+}
+
+// Unwrap reports the move as illegal, and also as forbidden when the move
+// exists but is reserved for other roles.
+func (e *TransitionError) Unwrap() []error {
+	if roles, ok := edges[e.From][e.To]; ok && !allows(roles, e.Role) {
+		return []error{ErrIllegalTransition, ErrForbidden}
+	}
+	return []error{ErrIllegalTransition}
+}
+
+// Listener is called after every successful transition with the updated
+// order. Listeners run on the request path and must not block.
+type Listener func(order models.Order, change models.StatusChange)
+
+// Recorder is called with the updated order while a transition is being
+// stored, using the same context. When the store runs the transition in a
+// transaction the recorder's writes commit or roll back with it; an error
+// fails the transition.
+type Recorder func(ctx context.Context, order models.Order, change models.StatusChange) error
+
+var (
+	listenersMu sync.RWMutex
+	listeners   []Listener
+	recorders   []Recorder
+)
+
+// Listen registers a listener for all transitions.
+func Listen(l Listener) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listeners = append(listeners, l)
+}
+
+// Notify informs the registered listeners of a transition. Stores call it
+// once the move is stored.
+func Notify(order models.Order, change models.StatusChange) {
+	listenersMu.RLock()
+	defer listenersMu.RUnlock()
+	for _, l := range listeners {
+		l(order, change)
+	}
+}
+
+// Record registers a recorder for all transitions.
+func Record(r Recorder) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	recorders = append(recorders, r)
+}
+
+// Recorded runs the registered recorders for a transition and stops at the
+// first error. Move calls it; stores that apply transitions themselves must
+// call it before the move is committed.
+func Recorded(ctx context.Context, order models.Order, change models.StatusChange) error {
+	listenersMu.RLock()
+	defer listenersMu.RUnlock()
+	for _, r := range recorders {
+		if err := r(ctx, order, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transition describes a requested status change and who is making it. Set
+// holds extra fields stored in the same update as the status. Guard, when
+// set, can veto the move after seeing the order in its current status.
+type Transition struct {
+	To         string
+	By         Role
+	ActorID    uint
+	Reason     string
+	ReasonCode string
+	Set        bson.M
+	Guard      func(order models.Order) error
+}
+
+// Change builds the history entry recorded for a move from the given status.
+func (t Transition) Change(from string) models.StatusChange {
+	return models.StatusChange{
+		From:       from,
+		To:         t.To,
+		ActorType:  string(t.By),
+		ActorID:    t.ActorID,
+		At:         time.Now().UTC(),
+		Reason:     t.Reason,
+		ReasonCode: t.ReasonCode,
+	}
+}
+
+// Known reports whether status is part of the state machine.
+func Known(status string) bool {
+	_, ok := edges[status]
+	return ok
+}
+
+// Adjustable reports whether a merchant may still change the items of an
+// order in the given status.
+func Adjustable(status string) bool {
+	return status == Paid || status == Confirmed
+}
+
+// Final reports whether status is one an order never leaves.
+func Final(status string) bool {
+	next, ok := edges[status]
+	return ok && len(next) == 0
+}
+
+// Tracked reports whether a delivery agent is carrying an order in the given
+// status and may report its location.
+func Tracked(status string) bool {
+	return status == Assigned || status == InTransit
+}
+
+// Check validates that role may move an order from one status to another.
+func Check(from, to string, role Role) error {
+	if !Known(from) || !Known(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrUnknownStatus, from, to)
+	}
+	if allows(edges[from][to], role) {
+		return nil
+	}
+	return &TransitionError{From: from, To: to, Role: role}
+}
+
+func allows(roles []Role, role Role) bool {
+	for _, allowed := range roles {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Move loads the order matched by filter, validates the transition, stores
+// the new status, appends the change to the order history and runs the
+// registered recorders. The update only applies if the order is still in the
+// status that was validated; otherwise ErrConflict is returned. The returned
+// order is the document as stored after the update. Listeners are not
+// informed, so callers running Move in a transaction can call Notify once it
+// commits.
+func Move(ctx context.Context, collection *mongo.Collection, filter bson.M, t Transition) (models.Order, models.StatusChange, error) {
+	var order models.Order
+	err := collection.FindOne(ctx, filter).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return order, models.StatusChange{}, ErrNotFound
+	}
+	if err != nil {
+		return order, models.StatusChange{}, err
+	}
+
+	if err := Check(order.Status, t.To, t.By); err != nil {
+		return order, models.StatusChange{}, err
+	}
+	if t.Guard != nil {
+		if err := t.Guard(order); err != nil {
+			return order, models.StatusChange{}, err
+		}
+	}
+
+	expected := bson.M{"_id": order.OrderID, "status": order.Status}
+	change := t.Change(order.Status)
+	set := bson.M{"status": t.To, "updatedAt": change.At}
+	for field, value := range t.Set {
+		set[field] = value
+	}
+	update := bson.M{
+		"$set":  set,
+		"$push": bson.M{"history": change},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var updated models.Order
+	err = collection.FindOneAndUpdate(ctx, expected, update, opts).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return order, change, ErrConflict
+	}
+	if err != nil {
+		return order, change, err
+	}
+
+	if err := Recorded(ctx, updated, change); err != nil {
+		return updated, change, err
+	}
+	return updated, change, nil
+}
@@ -0,0 +1,120 @@
+package lifecycle
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		from, to string
+		role     Role
+		want     error
+	}{
+		{PendingPayment, Paid, System, nil},
+		{PendingPayment, Paid, Customer, ErrForbidden},
+		{PendingPayment, Cancelled, Customer, nil},
+		{PendingPayment, Cancelled, Merchant, ErrForbidden},
+		{PendingPayment, Confirmed, Merchant, ErrIllegalTransition},
+		{Paid, Confirmed, Merchant, nil},
+		{Paid, Confirmed, Customer, ErrForbidden},
+		{Paid, Paid, System, ErrIllegalTransition},
+		{Paid, Ready, Merchant, ErrIllegalTransition},
+		{Paid, Cancelled, Customer, nil},
+		{Paid, Cancelled, Merchant, nil},
+		{Paid, Cancelled, DeliveryAgent, ErrForbidden},
+		{Confirmed, Ready, Merchant, nil},
+		{Confirmed, Ready, DeliveryAgent, ErrForbidden},
+		{Ready, Assigned, DeliveryAgent, nil},
+		{Ready, Assigned, Merchant, ErrForbidden},
+		{Ready, Cancelled, DeliveryAgent, ErrForbidden},
+		{Assigned, InTransit, Merchant, nil},
+		{Assigned, InTransit, DeliveryAgent, ErrForbidden},
+		{Assigned, Cancelled, DeliveryAgent, nil},
+		{Assigned, Delivered, DeliveryAgent, ErrIllegalTransition},
+		{InTransit, Delivered, DeliveryAgent, nil},
+		{InTransit, Delivered, Customer, ErrForbidden},
+		{InTransit, Cancelled, Merchant, ErrForbidden},
+		{InTransit, Ready, Merchant, ErrIllegalTransition},
+		{Delivered, Cancelled, Customer, ErrIllegalTransition},
+		{Cancelled, Paid, System, ErrIllegalTransition},
+		{"Shipped", Delivered, DeliveryAgent, ErrUnknownStatus},
+		{Paid, "Refunded", System, ErrUnknownStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to+" as "+string(tt.role), func(t *testing.T) {
+			err := Check(tt.from, tt.to, tt.role)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Check = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Check = %v, want %v", err, tt.want)
+			}
+			if tt.want == ErrIllegalTransition && errors.Is(err, ErrForbidden) {
+				t.Errorf("Check = %v, a move that does not exist is not forbidden", err)
+			}
+			if tt.want == ErrForbidden && !errors.Is(err, ErrIllegalTransition) {
+				t.Errorf("Check = %v, a forbidden move is also illegal", err)
+			}
+		})
+	}
+}
+
+// Every status is reachable from PendingPayment and every edge leads to a
+// known status with at least one role allowed to take it.
+func TestEdges(t *testing.T) {
+	reached := map[string]bool{PendingPayment: true}
+	queue := []string{PendingPayment}
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+		for to, roles := range edges[from] {
+			if !Known(to) {
+				t.Errorf("%s leads to unknown status %s", from, to)
+			}
+			if len(roles) == 0 {
+				t.Errorf("no role may move from %s to %s", from, to)
+			}
+			if !reached[to] {
+				reached[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+	for status := range edges {
+		if !reached[status] {
+			t.Errorf("%s cannot be reached", status)
+		}
+	}
+
+	for _, status := range []string{Delivered, Cancelled} {
+		if !Final(status) {
+			t.Errorf("%s is not final", status)
+		}
+	}
+	for status := range edges {
+		if status != Delivered && status != Cancelled && Final(status) {
+			t.Errorf("%s is final", status)
+		}
+	}
+}
+
+func TestChangeRecordsActor(t *testing.T) {
+	change := Transition{To: Cancelled, By: Merchant, ActorID: 7, Reason: "closing early", ReasonCode: ReasonStoreClosed}.Change(Paid)
+
+	if change.From != Paid || change.To != Cancelled {
+		t.Errorf("change moves from %s to %s, want %s to %s", change.From, change.To, Paid, Cancelled)
+	}
+	if change.ActorType != string(Merchant) || change.ActorID != 7 {
+		t.Errorf("change made by %s %d, want merchant 7", change.ActorType, change.ActorID)
+	}
+	if change.Reason != "closing early" || change.ReasonCode != ReasonStoreClosed {
+		t.Errorf("change reason %q (%s), want the given reason", change.Reason, change.ReasonCode)
+	}
+	if change.At.IsZero() || change.At.Location().String() != "UTC" {
+		t.Errorf("change at %v, want the current UTC time", change.At)
+	}
+}
@@ -5,9 +5,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/CS559-CSD-IITBH/order-service/board"
+	"github.com/CS559-CSD-IITBH/order-service/catalog"
+	"github.com/CS559-CSD-IITBH/order-service/db"
+	"github.com/CS559-CSD-IITBH/order-service/dispatch"
+	"github.com/CS559-CSD-IITBH/order-service/events"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/migrations"
+	"github.com/CS559-CSD-IITBH/order-service/notification"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
 	"github.com/CS559-CSD-IITBH/order-service/routes"
+	"github.com/CS559-CSD-IITBH/order-service/tracking"
 	"github.com/gorilla/sessions"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -41,6 +55,7 @@ func main() {
 	if err != nil {
 		log.Fatal("Internal server error: Unable to talk to Mongo")
 	}
+	cancel()
 
 	fmt.Println("Connected to MongoDB!")
 
@@ -48,6 +63,42 @@ func main() {
 	// For example, you can access a collection:
 	orderCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_ORDER"))
 	cartCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_CART"))
+	itemCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_ITEM"))
+	agentCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_AGENT"))
+	locationCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_LOCATION"))
+	merchantEventCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_MERCHANT_EVENT"))
+	counterCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_COUNTER"))
+	storeCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_STORE"))
+	paymentEventCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_PAYMENT_EVENT"))
+	migrationCollection := client.Database(os.Getenv("MONGO_DB_NAME")).Collection(os.Getenv("MONGO_COLLECTION_MIGRATION"))
+
+	// Stored documents are upgraded by numbered migrations, either with the
+	// migrate subcommand or on startup when MIGRATE_ON_STARTUP is set
+	collections := migrations.Collections{
+		Orders:         orderCollection,
+		Carts:          cartCollection,
+		Trail:          locationCollection,
+		Stores:         storeCollection,
+		MerchantEvents: merchantEventCollection,
+	}
+	migrationRunner := migrations.NewRunner(migrations.NewMongoHistory(migrationCollection), collections, migrations.All())
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(context.Background(), migrationRunner, collections, os.Args[2:]))
+	}
+	if os.Getenv("MIGRATE_ON_STARTUP") == "true" {
+		if err := migrateOnStartup(context.Background(), migrationRunner); err != nil {
+			log.Fatalln("Internal server error: Unable to apply migrations:", err)
+		}
+	} else {
+		var pending []migrations.Migration
+		err := withTimeout(func(ctx context.Context) (err error) {
+			pending, err = migrationRunner.Pending(ctx)
+			return err
+		})
+		if err == nil && len(pending) > 0 {
+			fmt.Println("There are pending migrations, run the migrate subcommand or set MIGRATE_ON_STARTUP")
+		}
+	}
 
 	// Session store in  NewFilesystemStore
 	store := sessions.NewFilesystemStore("sessions/", []byte("secret-key"))
@@ -62,6 +113,158 @@ func main() {
 		log.Fatalln("Internal server error: Unable to connect to the DB")
 	}
 
-	r := routes.SetupRouter(orderCollection, cartCollection, store)
+	// Carts expire after CART_TTL_HOURS without an update
+	cartTTL := envHours("CART_TTL_HOURS", 72)
+	if err := withTimeout(func(ctx context.Context) error { return db.EnsureCartIndexes(ctx, cartCollection, cartTTL) }); err != nil {
+		log.Fatalln("Internal server error: Unable to create cart indexes")
+	}
+
+	// Controllers and services only see the repositories, never the collections
+	orders := repository.NewMongoOrders(orderCollection)
+	carts := repository.NewMongoCarts(cartCollection)
+	stores := repository.NewMongoStores(storeCollection)
+	tx := repository.NewMongoTransactor(client)
+
+	// Orders are priced against the store catalog, never the client payload
+	prices := catalog.NewMongoSource(itemCollection)
+
+	// Payments go through Razorpay unless the fake gateway is asked for
+	var gateway payment.Gateway
+	switch os.Getenv("PAYMENT_GATEWAY") {
+	case "", "razorpay":
+		gateway, err = payment.NewRazorpay(os.Getenv("RAZORPAY_KEY_ID"), os.Getenv("RAZORPAY_KEY_SECRET"), os.Getenv("RAZORPAY_WEBHOOK_SECRET"))
+		if err != nil {
+			log.Fatalln("Internal server error: RAZORPAY_KEY_ID, RAZORPAY_KEY_SECRET and RAZORPAY_WEBHOOK_SECRET must be set")
+		}
+	case "fake":
+		fmt.Println("PAYMENT_GATEWAY is fake, no payments are collected")
+		gateway, err = payment.NewFake()
+		if err != nil {
+			log.Fatalln("Internal server error: Unable to create the fake payment gateway")
+		}
+	default:
+		log.Fatalln("Internal server error: Invalid PAYMENT_GATEWAY")
+	}
+
+	// Webhook deliveries are deduplicated by provider event ID
+	webhookEvents := repository.NewMongoWebhookEvents(paymentEventCollection)
+
+	// Cancellation rules can be tightened or relaxed per deployment
+	policy := lifecycle.DefaultCancellationPolicy()
+	if statuses := os.Getenv("CANCEL_CUSTOMER_STATUSES"); statuses != "" {
+		policy.CustomerStatuses, err = lifecycle.ParseStatuses(statuses)
+		if err != nil {
+			log.Fatalln("Internal server error: Invalid CANCEL_CUSTOMER_STATUSES:", err)
+		}
+	}
+	if fee := os.Getenv("CANCEL_FEE_PERCENT"); fee != "" {
+		policy.FeePercent, err = strconv.ParseFloat(fee, 64)
+		if err != nil || policy.FeePercent < 0 || policy.FeePercent > 100 {
+			log.Fatalln("Internal server error: Invalid CANCEL_FEE_PERCENT")
+		}
+	}
+
+	// Handoff OTPs are stored as hashes keyed with OTP_SECRET
+	otpSecret := os.Getenv("OTP_SECRET")
+	if otpSecret == "" {
+		log.Fatalln("Internal server error: OTP_SECRET is not set")
+	}
+	maxAttempts, err := strconv.Atoi(os.Getenv("OTP_MAX_ATTEMPTS"))
+	if err != nil || maxAttempts <= 0 {
+		maxAttempts = 5
+	}
+	issuer := otp.NewIssuer(otpSecret, envMinutes("OTP_TTL_MINUTES", 30), maxAttempts)
+
+	// Notifications are written to NOTIFICATION_LOG_FILE, or stdout, until a
+	// real SMS, email and push provider is configured
+	notificationLog := os.Stdout
+	if path := os.Getenv("NOTIFICATION_LOG_FILE"); path != "" {
+		notificationLog, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalln("Internal server error: Unable to open the notification log")
+		}
+	}
+	notifier := notification.NewDispatcher(notification.NewLogNotifier(notificationLog), 1024)
+	lifecycle.Listen(notifier.OrderTransitioned)
+
+	// Ready orders are offered to delivery agents who are online and under
+	// capacity, first to accept gets it
+	capacity, err := strconv.Atoi(os.Getenv("AGENT_DEFAULT_CAPACITY"))
+	if err != nil || capacity <= 0 || capacity > dispatch.MaxCapacity {
+		capacity = 2
+	}
+	agents := dispatch.NewAgents(repository.NewMongoAgents(agentCollection), orders, capacity)
+	pool := dispatch.NewPool(orders, agents, notifier)
+	lifecycle.Listen(pool.OrderTransitioned)
+
+	// Agents report their position while carrying an order, customers see the
+	// latest position and the trail
+	if err := withTimeout(func(ctx context.Context) error { return db.EnsureTrailIndexes(ctx, locationCollection) }); err != nil {
+		log.Fatalln("Internal server error: Unable to create location indexes")
+	}
+	tracker := tracking.NewTracker(orders, repository.NewMongoTrail(locationCollection))
+
+	// Order streams follow the orders collection's change stream so every
+	// instance sees every change; a standalone server falls back to events
+	// published in process
+	hub := events.NewHub()
+	if err := hub.Watch(context.Background(), orderCollection); err != nil {
+		fmt.Println("Change streams unavailable, publishing order events in process:", err)
+		lifecycle.Listen(hub.OrderTransitioned)
+		tracker.Listen(hub.LocationRecorded)
+	}
+
+	// Merchants watch new paid orders, cancellations and agent assignments on
+	// a board they can resume from the last sequence number they saw
+	if err := withTimeout(func(ctx context.Context) error { return db.EnsureMerchantEventIndexes(ctx, merchantEventCollection) }); err != nil {
+		log.Fatalln("Internal server error: Unable to create merchant event indexes")
+	}
+	orderBoard := board.NewBoard(repository.NewMongoMerchantEvents(merchantEventCollection, counterCollection))
+	lifecycle.Record(orderBoard.Record)
+	lifecycle.Listen(orderBoard.OrderTransitioned)
+
+	// Merchants act on the store they run, looked up by their account ID
+	if err := withTimeout(func(ctx context.Context) error { return db.EnsureStoreIndexes(ctx, storeCollection) }); err != nil {
+		log.Fatalln("Internal server error: Unable to create store indexes")
+	}
+
+	var allowedOrigins []string
+	if origins := os.Getenv("ALLOWED_ORIGINS"); origins != "" {
+		for _, origin := range strings.Split(origins, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				allowedOrigins = append(allowedOrigins, origin)
+			}
+		}
+	}
+
+	r := routes.SetupRouter(orders, carts, stores, tx, prices, gateway, webhookEvents, policy, issuer, notifier, pool, agents, tracker, hub, orderBoard, envHours("ABANDONED_CART_HOURS", 24), allowedOrigins, store)
 	r.Run(":" + os.Getenv("PORT"))
 }
+
+// withTimeout runs one startup call to Mongo under its own deadline, so a
+// slow step such as a migration does not use up the time of the next one.
+func withTimeout(step func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return step(ctx)
+}
+
+// envHours reads a number of hours from the environment, falling back to the
+// given default when the variable is unset or invalid.
+func envHours(key string, fallback int) time.Duration {
+	hours, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || hours <= 0 {
+		hours = fallback
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// envMinutes reads a number of minutes from the environment, falling back to
+// the given default when the variable is unset or invalid.
+func envMinutes(key string, fallback int) time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || minutes <= 0 {
+		minutes = fallback
+	}
+	return time.Duration(minutes) * time.Minute
+}
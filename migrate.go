@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/migrations"
+)
+
+const migrateUsage = `usage: order-service migrate <command>
+
+commands:
+  run                    apply pending migrations
+  rollback [-steps n]    undo the last n applied migrations, default 1
+  status                 list migrations and when they were applied
+  stores <pairs>         record which store each merchant runs, as
+                         merchantID=storeID pairs separated by commas`
+
+// lockPoll is how often a starting instance checks whether another instance
+// finished migrating.
+const lockPoll = 5 * time.Second
+
+// migrateOnStartup applies the pending migrations as the service starts.
+// When several instances start at once only one takes the lock; the others
+// wait for it and try again, which applies nothing once its run succeeded
+// and picks up the remaining migrations if it failed.
+func migrateOnStartup(ctx context.Context, runner *migrations.Runner) error {
+	for {
+		ran, err := runner.Up(ctx)
+		for _, migration := range ran {
+			fmt.Printf("Applied migration %d %s\n", migration.Version, migration.Name)
+		}
+		if !errors.Is(err, migrations.ErrLocked) {
+			return err
+		}
+
+		fmt.Println("Another instance is applying migrations, waiting for it to finish")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+// runMigrate runs the migrate subcommand and returns the process exit code.
+func runMigrate(ctx context.Context, runner *migrations.Runner, collections migrations.Collections, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "run":
+		ran, err := runner.Up(ctx)
+		for _, migration := range ran {
+			fmt.Printf("Applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Migration failed:", err)
+			return 1
+		}
+		if len(ran) == 0 {
+			fmt.Println("No pending migrations")
+		}
+
+	case "rollback":
+		flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to undo")
+		if err := flags.Parse(args[1:]); err != nil || *steps <= 0 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		undone, err := runner.Rollback(ctx, *steps)
+		for _, migration := range undone {
+			fmt.Printf("Rolled back %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Rollback failed:", err)
+			return 1
+		}
+		if len(undone) == 0 {
+			fmt.Println("No applied migrations")
+		}
+
+	case "status":
+		states, err := runner.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to read migration status:", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", state.Version, state.Name, appliedAt)
+		}
+		w.Flush()
+
+	case "stores":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		mapping, err := migrations.ParseStores(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Invalid stores:", err)
+			return 2
+		}
+		if err := migrations.SeedStores(ctx, collections.Stores, mapping); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to seed stores:", err)
+			return 1
+		}
+		fmt.Println("Stores seeded:", len(mapping))
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,116 @@
+package migrations
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/CS559-CSD-IITBH/order-service/db"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// agentIdentity moves delivery agent IDs, which used to be strings under
+// deliveryInfo.deliveryAgentUID and on trail points, to numbers under
+// deliveryInfo.deliveryAgentID and agentID, and drops the unused
+// deliveryInfo.currentLocation field. It also creates the store indexes;
+// stores themselves are seeded with the stores command, since nothing in the
+// old documents links a merchant account to a store.
+//
+// IDs that are not numbers are left as they are for someone to look at.
+// Rolling back restores the string IDs but not currentLocation.
+var agentIdentity = Migration{
+	Version: 1,
+	Name:    "agent_identity",
+	Up: func(ctx context.Context, c Collections) error {
+		// Agent IDs stored as strings, under either name
+		if err := convertAgentIDs(ctx, c.Orders, "deliveryInfo.deliveryAgentUID", "deliveryInfo.deliveryAgentID"); err != nil {
+			return err
+		}
+		if err := convertAgentIDs(ctx, c.Orders, "deliveryInfo.deliveryAgentID", "deliveryInfo.deliveryAgentID"); err != nil {
+			return err
+		}
+
+		_, err := c.Orders.UpdateMany(ctx, bson.M{"deliveryInfo.currentLocation": bson.M{"$exists": true}},
+			bson.M{"$unset": bson.M{"deliveryInfo.currentLocation": ""}})
+		if err != nil {
+			return err
+		}
+
+		if err := convertAgentIDs(ctx, c.Trail, "agentID", "agentID"); err != nil {
+			return err
+		}
+
+		return db.EnsureStoreIndexes(ctx, c.Stores)
+	},
+	Down: func(ctx context.Context, c Collections) error {
+		_, err := c.Orders.UpdateMany(ctx, bson.M{"deliveryInfo.deliveryAgentID": bson.M{"$type": "number"}}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"deliveryInfo.deliveryAgentUID": bson.M{"$toString": "$deliveryInfo.deliveryAgentID"}}}},
+			{{Key: "$unset", Value: "deliveryInfo.deliveryAgentID"}},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = c.Trail.UpdateMany(ctx, bson.M{"agentID": bson.M{"$type": "number"}}, mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"agentID": bson.M{"$toString": "$agentID"}}}},
+		})
+		return err
+	},
+}
+
+// convertAgentIDs moves the string agent IDs at field in collection to
+// numbers at to. Documents whose ID is not a number are left alone.
+func convertAgentIDs(ctx context.Context, collection *mongo.Collection, field, to string) error {
+	cursor, err := collection.Find(ctx, bson.M{field: bson.M{"$type": "string"}},
+		options.Find().SetProjection(bson.M{field: 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		value, ok := cursor.Current.Lookup(strings.Split(field, ".")...).StringValueOK()
+		if !ok {
+			continue
+		}
+		update, ok := agentIDUpdate(value, field, to)
+		if !ok {
+			continue
+		}
+		filter := bson.M{"_id": cursor.Current.Lookup("_id"), field: value}
+		if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// agentIDUpdate returns the update that replaces the string agent ID value
+// at field with a number at to. The empty string meant no agent and is
+// removed; it reports false for any other string that is not a number.
+func agentIDUpdate(value, field, to string) (bson.M, bool) {
+	if value == "" {
+		return bson.M{"$unset": bson.M{field: ""}}, true
+	}
+	id, ok := numericID(value)
+	if !ok {
+		return nil, false
+	}
+
+	update := bson.M{"$set": bson.M{to: id}}
+	if field != to {
+		update["$unset"] = bson.M{field: ""}
+	}
+	return update, true
+}
+
+// numericID parses an agent ID stored as a string of digits.
+func numericID(value string) (int64, bool) {
+	if value == "" || value[0] < '0' || value[0] > '9' {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	return id, err == nil
+}
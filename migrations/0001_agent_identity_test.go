@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestAgentIDUpdate(t *testing.T) {
+	const uid, id = "deliveryInfo.deliveryAgentUID", "deliveryInfo.deliveryAgentID"
+
+	tests := []struct {
+		name  string
+		value string
+		field string
+		want  bson.M
+		ok    bool
+	}{
+		{"number under the old name", "42", uid, bson.M{"$set": bson.M{id: int64(42)}, "$unset": bson.M{uid: ""}}, true},
+		{"number in place", "42", id, bson.M{"$set": bson.M{id: int64(42)}}, true},
+		{"empty means no agent", "", uid, bson.M{"$unset": bson.M{uid: ""}}, true},
+		{"letters", "agent-7", uid, nil, false},
+		{"signed", "-7", id, nil, false},
+		{"plus sign", "+7", id, nil, false},
+		{"spaces", " 7", id, nil, false},
+		{"exponent", "7e3", id, nil, false},
+		{"too large", "92233720368547758070", id, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := agentIDUpdate(tt.value, tt.field, id)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("agentIDUpdate(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
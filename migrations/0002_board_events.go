@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// boardOrderFields are the order fields a merchant board event keeps, the
+// fields of models.BoardOrder.
+var boardOrderFields = []string{"_id", "status", "items", "totalAmount", "createdAt", "updatedAt"}
+
+// boardEvents trims the orders stored on merchant board events, which used
+// to be whole orders including the OTP hashes and payment details, down to
+// the fields shown on the board. The dropped fields are gone, so it cannot
+// be rolled back.
+var boardEvents = Migration{
+	Version: 2,
+	Name:    "board_events",
+	Up: func(ctx context.Context, c Collections) error {
+		// Whole orders always have a payment field, trimmed ones never do
+		_, err := c.MerchantEvents.UpdateMany(ctx, bson.M{"order.payment": bson.M{"$exists": true}}, boardOrderPipeline())
+		return err
+	},
+}
+
+// boardOrderPipeline replaces the stored order with just its board fields.
+func boardOrderPipeline() mongo.Pipeline {
+	order := bson.M{}
+	for _, field := range boardOrderFields {
+		order[field] = "$order." + field
+	}
+	return mongo.Pipeline{{{Key: "$set", Value: bson.M{"order": order}}}}
+}
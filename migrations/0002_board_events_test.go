@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The migration must keep exactly what new board events store.
+func TestBoardOrderFieldsMatchModel(t *testing.T) {
+	raw, err := bson.Marshal(models.BoardOrder{})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	elements, err := bson.Raw(raw).Elements()
+	if err != nil {
+		t.Fatalf("elements: %v", err)
+	}
+
+	var model []string
+	for _, element := range elements {
+		model = append(model, element.Key())
+	}
+	kept := append([]string(nil), boardOrderFields...)
+	sort.Strings(model)
+	sort.Strings(kept)
+	if len(model) != len(kept) {
+		t.Fatalf("migration keeps %v, BoardOrder stores %v", kept, model)
+	}
+	for i := range model {
+		if model[i] != kept[i] {
+			t.Fatalf("migration keeps %v, BoardOrder stores %v", kept, model)
+		}
+	}
+
+	set := boardOrderPipeline()[0][0].Value.(bson.M)["order"].(bson.M)
+	for _, field := range boardOrderFields {
+		if set[field] != "$order."+field {
+			t.Errorf("pipeline sets %s to %v, want $order.%s", field, set[field], field)
+		}
+	}
+}
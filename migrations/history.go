@@ -0,0 +1,156 @@
+package migrations
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// History records which migrations have been applied and holds the lock that
+// keeps two runs from migrating at once.
+type History interface {
+	// Applied returns when each applied version was applied.
+	Applied(ctx context.Context) (map[int]time.Time, error)
+	Record(ctx context.Context, version int, name string, at time.Time) error
+	Forget(ctx context.Context, version int) error
+
+	// Lock takes the lock for holder at now. It returns ErrLocked if another
+	// holder took it after staleBefore.
+	Lock(ctx context.Context, holder string, now, staleBefore time.Time) error
+
+	// Unlock releases the lock if holder still holds it, and returns
+	// ErrLockLost if another holder took it over.
+	Unlock(ctx context.Context, holder string) error
+}
+
+// lockID is the _id of the lock document in the history collection; applied
+// migrations use their version as _id.
+const lockID = "lock"
+
+type applied struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"appliedAt"`
+}
+
+// MongoHistory records applied migrations in a MongoDB collection, one
+// document per version next to the lock document.
+type MongoHistory struct {
+	collection *mongo.Collection
+}
+
+func NewMongoHistory(collection *mongo.Collection) *MongoHistory {
+	return &MongoHistory{collection: collection}
+}
+
+func (h *MongoHistory) Applied(ctx context.Context) (map[int]time.Time, error) {
+	cursor, err := h.collection.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []applied
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	done := make(map[int]time.Time, len(records))
+	for _, record := range records {
+		done[record.Version] = record.AppliedAt
+	}
+	return done, nil
+}
+
+func (h *MongoHistory) Record(ctx context.Context, version int, name string, at time.Time) error {
+	_, err := h.collection.InsertOne(ctx, applied{Version: version, Name: name, AppliedAt: at})
+	return err
+}
+
+func (h *MongoHistory) Forget(ctx context.Context, version int) error {
+	_, err := h.collection.DeleteOne(ctx, bson.M{"_id": version})
+	return err
+}
+
+// Lock upserts the lock document only when it is missing or stale, so a
+// fresh lock makes the upsert collide with the existing document.
+func (h *MongoHistory) Lock(ctx context.Context, holder string, now, staleBefore time.Time) error {
+	_, err := h.collection.UpdateOne(ctx,
+		bson.M{"_id": lockID, "lockedAt": bson.M{"$lt": staleBefore}},
+		bson.M{"$set": bson.M{"lockedAt": now, "holder": holder}},
+		options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	return err
+}
+
+func (h *MongoHistory) Unlock(ctx context.Context, holder string) error {
+	result, err := h.collection.DeleteOne(ctx, bson.M{"_id": lockID, "holder": holder})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// MemoryHistory keeps applied migrations and the lock in memory.
+type MemoryHistory struct {
+	mu       sync.Mutex
+	applied  map[int]time.Time
+	holder   string
+	lockedAt time.Time
+}
+
+func NewMemoryHistory() *MemoryHistory {
+	return &MemoryHistory{applied: make(map[int]time.Time)}
+}
+
+func (h *MemoryHistory) Applied(_ context.Context) (map[int]time.Time, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	done := make(map[int]time.Time, len(h.applied))
+	for version, at := range h.applied {
+		done[version] = at
+	}
+	return done, nil
+}
+
+func (h *MemoryHistory) Record(_ context.Context, version int, _ string, at time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.applied[version] = at
+	return nil
+}
+
+func (h *MemoryHistory) Forget(_ context.Context, version int) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.applied, version)
+	return nil
+}
+
+func (h *MemoryHistory) Lock(_ context.Context, holder string, now, staleBefore time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holder != "" && !h.lockedAt.Before(staleBefore) {
+		return ErrLocked
+	}
+	h.holder, h.lockedAt = holder, now
+	return nil
+}
+
+func (h *MemoryHistory) Unlock(_ context.Context, holder string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.holder != holder {
+		return ErrLockLost
+	}
+	h.holder = ""
+	return nil
+}
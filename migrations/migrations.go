@@ -0,0 +1,202 @@
+// Package migrations upgrades stored documents as the models evolve. Each
+// migration has a version number and is applied at most once; applied
+// versions are recorded in their own collection.
+package migrations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrLocked       = errors.New("another migration run is in progress")
+	ErrLockLost     = errors.New("the migration lock was taken over by another run")
+	ErrIrreversible = errors.New("migration cannot be rolled back")
+)
+
+// lockTTL is how long a run may hold the lock before another run may take it
+// over, in case the holder died without releasing it.
+const lockTTL = 15 * time.Minute
+
+// Collections are the collections migrations may rewrite.
+type Collections struct {
+	Orders         *mongo.Collection
+	Carts          *mongo.Collection
+	Trail          *mongo.Collection
+	Stores         *mongo.Collection
+	MerchantEvents *mongo.Collection
+}
+
+// Migration is one numbered change to the stored documents. Up and Down must
+// be safe to run again after a partial failure. Down is nil for migrations
+// that cannot be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, c Collections) error
+	Down    func(ctx context.Context, c Collections) error
+}
+
+// All lists the migrations in version order.
+func All() []Migration {
+	all := []Migration{
+		agentIdentity,
+		boardEvents,
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Version < all[j].Version })
+	return all
+}
+
+// State is a migration and when it was applied, nil if it is pending.
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Runner applies and rolls back migrations, recording applied versions in a
+// History.
+type Runner struct {
+	history     History
+	collections Collections
+	migrations  []Migration
+}
+
+func NewRunner(history History, collections Collections, migrations []Migration) *Runner {
+	return &Runner{history: history, collections: collections, migrations: migrations}
+}
+
+// Status lists every known migration with the time it was applied.
+func (r *Runner) Status(ctx context.Context) ([]State, error) {
+	done, err := r.history.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(r.migrations))
+	for _, migration := range r.migrations {
+		state := State{Migration: migration}
+		if appliedAt, ok := done[migration.Version]; ok {
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Pending lists the migrations that have not been applied, in order.
+func (r *Runner) Pending(ctx context.Context) ([]Migration, error) {
+	done, err := r.history.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range r.migrations {
+		if _, ok := done[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies the pending migrations in order and returns the ones it
+// applied. It stops at the first failure.
+func (r *Runner) Up(ctx context.Context) (ran []Migration, err error) {
+	holder, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if unlockErr := r.unlock(holder); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, migration := range pending {
+		if err := migration.Up(ctx, r.collections); err != nil {
+			return ran, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		if err := r.history.Record(ctx, migration.Version, migration.Name, time.Now().UTC()); err != nil {
+			return ran, fmt.Errorf("recording migration %d: %w", migration.Version, err)
+		}
+		ran = append(ran, migration)
+	}
+	return ran, nil
+}
+
+// Rollback undoes the last steps applied migrations, newest first, and
+// returns the ones it undid.
+func (r *Runner) Rollback(ctx context.Context, steps int) (undone []Migration, err error) {
+	holder, err := r.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if unlockErr := r.unlock(holder); unlockErr != nil && err == nil {
+			err = unlockErr
+		}
+	}()
+
+	states, err := r.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(states) - 1; i >= 0 && len(undone) < steps; i-- {
+		migration := states[i].Migration
+		if states[i].AppliedAt == nil {
+			continue
+		}
+		if migration.Down == nil {
+			return undone, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+		if err := migration.Down(ctx, r.collections); err != nil {
+			return undone, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+		}
+		if err := r.history.Forget(ctx, migration.Version); err != nil {
+			return undone, fmt.Errorf("forgetting migration %d: %w", migration.Version, err)
+		}
+		undone = append(undone, migration)
+	}
+	return undone, nil
+}
+
+// lock takes the run lock unless another run holds a fresh one, and returns
+// the token that identifies this run as the holder.
+func (r *Runner) lock(ctx context.Context) (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	holder := hex.EncodeToString(token)
+
+	now := time.Now().UTC()
+	if err := r.history.Lock(ctx, holder, now, now.Add(-lockTTL)); err != nil {
+		return "", err
+	}
+	return holder, nil
+}
+
+// unlock releases the lock if this run still holds it. A run that outlived
+// lockTTL may have lost the lock to another run, which must keep it.
+func (r *Runner) unlock(holder string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := r.history.Unlock(ctx, holder)
+	if err != nil && !errors.Is(err, ErrLockLost) {
+		return fmt.Errorf("releasing the migration lock: %w", err)
+	}
+	return err
+}
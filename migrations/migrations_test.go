@@ -0,0 +1,193 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// recording returns migrations with the given versions that log the steps
+// they run.
+func recording(log *[]string, versions ...int) []Migration {
+	var all []Migration
+	for _, version := range versions {
+		name := fmt.Sprintf("m%d", version)
+		all = append(all, Migration{
+			Version: version,
+			Name:    name,
+			Up: func(context.Context, Collections) error {
+				*log = append(*log, "up "+name)
+				return nil
+			},
+			Down: func(context.Context, Collections) error {
+				*log = append(*log, "down "+name)
+				return nil
+			},
+		})
+	}
+	return all
+}
+
+func TestUpAppliesPendingInOrder(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	var log []string
+	runner := NewRunner(history, Collections{}, recording(&log, 1, 2, 3))
+
+	if err := history.Record(ctx, 1, "m1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	ran, err := runner.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(ran) != 2 || ran[0].Version != 2 || ran[1].Version != 3 {
+		t.Errorf("Up ran %+v, want versions 2 and 3", ran)
+	}
+	if len(log) != 2 || log[0] != "up m2" || log[1] != "up m3" {
+		t.Errorf("steps = %v, want [up m2 up m3]", log)
+	}
+
+	applied, _ := history.Applied(ctx)
+	for _, version := range []int{1, 2, 3} {
+		if _, ok := applied[version]; !ok {
+			t.Errorf("version %d is not recorded", version)
+		}
+	}
+	if ran, err := runner.Up(ctx); err != nil || len(ran) != 0 {
+		t.Errorf("second Up ran %d migrations, %v; want none", len(ran), err)
+	}
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	var log []string
+	all := recording(&log, 1, 2, 3)
+	failure := errors.New("boom")
+	all[1].Up = func(context.Context, Collections) error { return failure }
+
+	ran, err := NewRunner(history, Collections{}, all).Up(ctx)
+	if !errors.Is(err, failure) {
+		t.Fatalf("Up error = %v, want %v", err, failure)
+	}
+	if len(ran) != 1 || ran[0].Version != 1 {
+		t.Errorf("Up ran %+v, want version 1", ran)
+	}
+	if applied, _ := history.Applied(ctx); len(applied) != 1 {
+		t.Errorf("recorded %v, want only version 1", applied)
+	}
+	if err := history.Lock(ctx, "next", time.Now(), time.Now().Add(-lockTTL)); err != nil {
+		t.Errorf("lock was not released after the failure: %v", err)
+	}
+}
+
+func TestRollbackUndoesNewestSteps(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	var log []string
+	runner := NewRunner(history, Collections{}, recording(&log, 1, 2, 3))
+	if _, err := runner.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	log = nil
+
+	undone, err := runner.Rollback(ctx, 2)
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if len(undone) != 2 || undone[0].Version != 3 || undone[1].Version != 2 {
+		t.Errorf("Rollback undid %+v, want versions 3 and 2", undone)
+	}
+	if len(log) != 2 || log[0] != "down m3" || log[1] != "down m2" {
+		t.Errorf("steps = %v, want [down m3 down m2]", log)
+	}
+	pending, _ := runner.Pending(ctx)
+	if len(pending) != 2 || pending[0].Version != 2 || pending[1].Version != 3 {
+		t.Errorf("pending after rollback = %+v, want versions 2 and 3", pending)
+	}
+}
+
+func TestRollbackStopsAtIrreversible(t *testing.T) {
+	ctx := context.Background()
+	var log []string
+	all := recording(&log, 1, 2)
+	all[0].Down = nil
+	runner := NewRunner(NewMemoryHistory(), Collections{}, all)
+	if _, err := runner.Up(ctx); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	undone, err := runner.Rollback(ctx, 2)
+	if !errors.Is(err, ErrIrreversible) {
+		t.Errorf("Rollback error = %v, want ErrIrreversible", err)
+	}
+	if len(undone) != 1 || undone[0].Version != 2 {
+		t.Errorf("Rollback undid %+v, want version 2", undone)
+	}
+}
+
+func TestFreshLockBlocksRuns(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	var log []string
+	runner := NewRunner(history, Collections{}, recording(&log, 1))
+
+	if err := history.Lock(ctx, "other", time.Now(), time.Now().Add(-lockTTL)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runner.Up(ctx); !errors.Is(err, ErrLocked) {
+		t.Errorf("Up error = %v, want ErrLocked", err)
+	}
+	if _, err := runner.Rollback(ctx, 1); !errors.Is(err, ErrLocked) {
+		t.Errorf("Rollback error = %v, want ErrLocked", err)
+	}
+	if len(log) != 0 {
+		t.Errorf("ran %v while locked", log)
+	}
+	if err := history.Unlock(ctx, "other"); err != nil {
+		t.Errorf("the other run lost its lock: %v", err)
+	}
+}
+
+func TestStaleLockIsTakenOver(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	var log []string
+	runner := NewRunner(history, Collections{}, recording(&log, 1))
+
+	lockedAt := time.Now().Add(-2 * lockTTL)
+	if err := history.Lock(ctx, "dead", lockedAt, lockedAt.Add(-lockTTL)); err != nil {
+		t.Fatal(err)
+	}
+	if ran, err := runner.Up(ctx); err != nil || len(ran) != 1 {
+		t.Fatalf("Up over a stale lock ran %d migrations, %v; want 1", len(ran), err)
+	}
+
+	// The run that held the stale lock must not release a lock it lost
+	if err := history.Unlock(ctx, "dead"); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Unlock by the old holder = %v, want ErrLockLost", err)
+	}
+}
+
+func TestUpReportsLostLock(t *testing.T) {
+	ctx := context.Background()
+	history := NewMemoryHistory()
+	all := []Migration{{
+		Version: 1,
+		Name:    "slow",
+		Up: func(ctx context.Context, _ Collections) error {
+			// Another run takes the lock over while this one is still going
+			return history.Lock(ctx, "other", time.Now(), time.Now().Add(time.Hour))
+		},
+	}}
+
+	if _, err := NewRunner(history, Collections{}, all).Up(ctx); !errors.Is(err, ErrLockLost) {
+		t.Errorf("Up error = %v, want ErrLockLost", err)
+	}
+	if err := history.Unlock(ctx, "other"); err != nil {
+		t.Errorf("the run released the lock of the run that took over: %v", err)
+	}
+}
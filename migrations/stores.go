@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ParseStores parses a comma separated list of merchantID=storeID pairs.
+func ParseStores(value string) (map[models.MerchantID]models.StoreID, error) {
+	mapping := make(map[models.MerchantID]models.StoreID)
+	for _, pair := range strings.Split(value, ",") {
+		merchant, store, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not merchantID=storeID", pair)
+		}
+		merchantID, err := strconv.ParseUint(merchant, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid merchant ID %q", merchant)
+		}
+		storeID, err := models.StoreIDFromHex(store)
+		if err != nil {
+			return nil, fmt.Errorf("invalid store ID %q", store)
+		}
+		mapping[models.MerchantID(merchantID)] = storeID
+	}
+	return mapping, nil
+}
+
+// SeedStores records which store each merchant runs.
+func SeedStores(ctx context.Context, stores *mongo.Collection, mapping map[models.MerchantID]models.StoreID) error {
+	for merchantID, storeID := range mapping {
+		_, err := stores.UpdateOne(ctx, bson.M{"_id": storeID},
+			bson.M{"$set": bson.M{"merchantID": merchantID}}, options.Update().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
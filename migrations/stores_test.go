@@ -0,0 +1,36 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+)
+
+func TestParseStores(t *testing.T) {
+	first, second := models.NewStoreID(), models.NewStoreID()
+
+	mapping, err := ParseStores("3=" + first.Hex() + ", 7=" + second.Hex())
+	if err != nil {
+		t.Fatalf("ParseStores: %v", err)
+	}
+	if len(mapping) != 2 || mapping[3] != first || mapping[7] != second {
+		t.Errorf("ParseStores = %v, want 3 and 7 mapped to their stores", mapping)
+	}
+
+	for _, value := range []string{
+		"",
+		"3",
+		first.Hex(),
+		"=" + first.Hex(),
+		"3=",
+		"x=" + first.Hex(),
+		"-3=" + first.Hex(),
+		"3=not-a-store",
+		"3=" + first.Hex() + ",",
+		"3:" + first.Hex(),
+	} {
+		if _, err := ParseStores(value); err == nil {
+			t.Errorf("ParseStores(%q) succeeded, want an error", value)
+		}
+	}
+}
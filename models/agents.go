@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Agent is the availability of a delivery agent. Active counts the orders
+// the agent is currently carrying and is computed from the orders, never
+// stored; new orders are only offered while the agent is online and Active
+// is below Capacity. HeldUntil is set while the agent is accepting an order.
+type Agent struct {
+	AgentID        AgentID    `bson:"_id" json:"id"`
+	Online         bool       `bson:"online" json:"online"`
+	Capacity       int        `bson:"capacity" json:"capacity"`
+	Active         int        `bson:"-" json:"active"`
+	ShiftStartedAt *time.Time `bson:"shiftStartedAt,omitempty" json:"shiftStartedAt,omitempty"`
+	LastSeenAt     time.Time  `bson:"lastSeenAt" json:"lastSeenAt"`
+	HeldUntil      *time.Time `bson:"heldUntil,omitempty" json:"-"`
+}
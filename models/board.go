@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MerchantEvent is an entry on a store's order board. Seq increases by one
+// for every event of the same store, so a client that saw Seq n can resume
+// from n without missing anything. Events are kept and replayed to every
+// board client, so they only carry a BoardOrder, never the whole order.
+type MerchantEvent struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	StoreID StoreID            `bson:"storeID" json:"storeID"`
+	Seq     int64              `bson:"seq" json:"seq"`
+	Type    string             `bson:"type" json:"type"`
+	Order   BoardOrder         `bson:"order" json:"order"`
+	Change  StatusChange       `bson:"change" json:"change"`
+	At      time.Time          `bson:"at" json:"at"`
+}
+
+// BoardOrder is the part of an order shown on the merchant board. It leaves
+// out the OTP hashes and the customer's payment details.
+type BoardOrder struct {
+	OrderID     primitive.ObjectID `bson:"_id" json:"id"`
+	Status      string             `bson:"status" json:"status"`
+	Items       []OrderItem        `bson:"items" json:"items"`
+	TotalAmount float64            `bson:"totalAmount" json:"totalAmount"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+func NewBoardOrder(order Order) BoardOrder {
+	return BoardOrder{
+		OrderID:     order.OrderID,
+		Status:      order.Status,
+		Items:       order.Items,
+		TotalAmount: order.TotalAmount,
+		CreatedAt:   order.CreatedAt,
+		UpdatedAt:   order.UpdatedAt,
+	}
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GeoPoint is a GeoJSON point. Coordinates are longitude then latitude.
+type GeoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// Location is a position reported by a delivery agent at RecordedAt.
+type Location struct {
+	Point      GeoPoint  `bson:"point" json:"point"`
+	RecordedAt time.Time `bson:"recordedAt" json:"recordedAt"`
+}
+
+// TrailPoint is one entry in the location trail of an order.
+type TrailPoint struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	OrderID    primitive.ObjectID `bson:"orderID" json:"-"`
+	AgentID    AgentID            `bson:"agentID" json:"-"`
+	Point      GeoPoint           `bson:"point" json:"point"`
+	RecordedAt time.Time          `bson:"recordedAt" json:"recordedAt"`
+}
@@ -1,17 +1,27 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Order struct {
 	OrderID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	StoreID      primitive.ObjectID `bson:"storeID" json:"storeID"`
-	UserID       uint               `bson:"userID" json:"userID"`
+	StoreID      StoreID            `bson:"storeID" json:"storeID"`
+	UserID       UserID             `bson:"userID" json:"userID"`
 	Items        []OrderItem        `bson:"items" json:"items"`
 	TotalAmount  float64            `bson:"totalAmount" json:"totalAmount"`
 	Status       string             `bson:"status" json:"status"`
 	DeliveryInfo DeliveryInfo       `bson:"deliveryInfo" json:"deliveryInfo"`
+	Payment      PaymentInfo        `bson:"payment" json:"payment"`
+	Refunds      []Refund           `bson:"refunds" json:"refunds"`
+	Adjustments  []Adjustment       `bson:"adjustments" json:"adjustments"`
+	PickupOTP    *OTP               `bson:"pickupOTP,omitempty" json:"-"`
+	DeliveryOTP  *OTP               `bson:"deliveryOTP,omitempty" json:"-"`
+	History      []StatusChange     `bson:"history" json:"history"`
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt    time.Time          `bson:"updatedAt" json:"updatedAt"`
 }
 
 type OrderItem struct {
@@ -20,9 +30,80 @@ type OrderItem struct {
 	Description string             `bson:"description" json:"description"`
 	Quantity    int                `bson:"quantity" json:"quantity"`
 	Price       float64            `bson:"price" json:"price"`
+	LineTotal   float64            `bson:"lineTotal" json:"lineTotal"`
 }
 
+// DeliveryInfo holds the account ID of the assigned delivery agent, zero until
+// an agent accepts the order, and the latest position they reported while
+// carrying it.
 type DeliveryInfo struct {
-	DeliveryAgentID string `bson:"deliveryAgentUID" json:"deliveryAgentUID"`
-	CurrentLocation string `bson:"currentLocation" json:"currentLocation"`
+	DeliveryAgentID AgentID   `bson:"deliveryAgentID,omitempty" json:"deliveryAgentID,omitempty"`
+	LastLocation    *Location `bson:"lastLocation,omitempty" json:"lastLocation,omitempty"`
+}
+
+// PaymentInfo tracks the gateway order an order is paid through. Amount is in
+// currency subunits and drops when part of the payment is refunded.
+type PaymentInfo struct {
+	GatewayOrderID string `bson:"gatewayOrderID" json:"gatewayOrderID"`
+	PaymentID      string `bson:"paymentID,omitempty" json:"paymentID,omitempty"`
+	Amount         int64  `bson:"amount" json:"amount"`
+	Currency       string `bson:"currency" json:"currency"`
+	Status         string `bson:"status" json:"status"`
+}
+
+// Refund tracks money returned to the customer for an order. Amounts are in
+// currency subunits; Fee is the cancellation fee withheld from the refund.
+// ID is assigned by the service so a refund can be found and retried even
+// when the gateway rejected it; RefundID is the gateway's ID and is empty
+// until the gateway accepts the refund. PaymentID is only set when a payment
+// other than the order's own was refunded.
+type Refund struct {
+	ID        primitive.ObjectID `bson:"id,omitempty" json:"id,omitempty"`
+	RefundID  string             `bson:"refundID" json:"refundID"`
+	PaymentID string             `bson:"paymentID,omitempty" json:"paymentID,omitempty"`
+	Amount    int64              `bson:"amount" json:"amount"`
+	Fee       int64              `bson:"fee,omitempty" json:"fee,omitempty"`
+	Status    string             `bson:"status" json:"status"`
+	Reason    string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
+
+// Adjustment records a merchant reducing or removing items after payment.
+// RefundAmount is in currency subunits.
+type Adjustment struct {
+	Items        []AdjustedItem `bson:"items" json:"items"`
+	RefundAmount int64          `bson:"refundAmount" json:"refundAmount"`
+	MerchantID   MerchantID     `bson:"merchantID" json:"merchantID"`
+	Reason       string         `bson:"reason,omitempty" json:"reason,omitempty"`
+	At           time.Time      `bson:"at" json:"at"`
+}
+
+// AdjustedItem is a single item change within an adjustment. A ToQuantity of
+// zero means the item was unavailable.
+type AdjustedItem struct {
+	ItemID       primitive.ObjectID `bson:"itemID" json:"itemID"`
+	Name         string             `bson:"name" json:"name"`
+	FromQuantity int                `bson:"fromQuantity" json:"fromQuantity"`
+	ToQuantity   int                `bson:"toQuantity" json:"toQuantity"`
+}
+
+// OTP is the stored form of a one time password used to hand an order over.
+type OTP struct {
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+	Attempts  int       `bson:"attempts"`
+}
+
+// StatusChange records a single move of an order from one status to another.
+// ActorID is the account ID of the user in the ActorType role, zero for the
+// system. ReasonCode is set when a merchant or delivery agent cancels an order.
+type StatusChange struct {
+	From       string    `bson:"from" json:"from"`
+	To         string    `bson:"to" json:"to"`
+	ActorType  string    `bson:"actorType" json:"actorType"`
+	ActorID    uint      `bson:"actorID" json:"actorID"`
+	At         time.Time `bson:"at" json:"at"`
+	Reason     string    `bson:"reason,omitempty" json:"reason,omitempty"`
+	ReasonCode string    `bson:"reasonCode,omitempty" json:"reasonCode,omitempty"`
 }
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Accounts, whether customer, merchant or delivery agent, are identified by
+// the uint user_id in the session. Each role gets its own type so an ID of
+// one kind cannot be used where another is expected.
+type (
+	UserID     uint
+	MerchantID uint
+	AgentID    uint
+)
+
+// StoreID identifies a store. Merchants act on their store through the
+// merchant to store mapping, never by their account ID. It is stored and sent
+// as an ObjectID.
+type StoreID primitive.ObjectID
+
+// NewStoreID returns a new unique store ID.
+func NewStoreID() StoreID {
+	return StoreID(primitive.NewObjectID())
+}
+
+// StoreIDFromHex parses the hex form of a store ID.
+func StoreIDFromHex(s string) (StoreID, error) {
+	id, err := primitive.ObjectIDFromHex(s)
+	return StoreID(id), err
+}
+
+func (id StoreID) Hex() string {
+	return primitive.ObjectID(id).Hex()
+}
+
+func (id StoreID) IsZero() bool {
+	return primitive.ObjectID(id).IsZero()
+}
+
+func (id StoreID) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(primitive.ObjectID(id))
+}
+
+func (id *StoreID) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	var oid primitive.ObjectID
+	if err := (bson.RawValue{Type: t, Value: data}).Unmarshal(&oid); err != nil {
+		return err
+	}
+	*id = StoreID(oid)
+	return nil
+}
+
+func (id StoreID) MarshalJSON() ([]byte, error) {
+	return json.Marshal(primitive.ObjectID(id))
+}
+
+func (id *StoreID) UnmarshalJSON(data []byte) error {
+	var oid primitive.ObjectID
+	if err := json.Unmarshal(data, &oid); err != nil {
+		return err
+	}
+	*id = StoreID(oid)
+	return nil
+}
+
+// Store is a store and the merchant account that runs it. A merchant runs at
+// most one store.
+type Store struct {
+	StoreID    StoreID    `bson:"_id" json:"id"`
+	MerchantID MerchantID `bson:"merchantID" json:"merchantID"`
+	Name       string     `bson:"name" json:"name"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Store IDs must keep the encoding of the ObjectIDs already stored and sent.
+func TestStoreIDEncodesAsObjectID(t *testing.T) {
+	oid := primitive.NewObjectID()
+	store := Store{StoreID: StoreID(oid), MerchantID: 3}
+
+	raw, err := bson.Marshal(store)
+	if err != nil {
+		t.Fatalf("bson marshal: %v", err)
+	}
+	if got := bson.Raw(raw).Lookup("_id"); got.Type != bson.TypeObjectID || got.ObjectID() != oid {
+		t.Errorf("_id encoded as %v %v, want ObjectID %s", got.Type, got, oid.Hex())
+	}
+	var decoded Store
+	if err := bson.Unmarshal(raw, &decoded); err != nil || decoded != store {
+		t.Errorf("bson round trip = %+v, %v; want %+v", decoded, err, store)
+	}
+
+	text, err := json.Marshal(store.StoreID)
+	if err != nil {
+		t.Fatalf("json marshal: %v", err)
+	}
+	if want := `"` + oid.Hex() + `"`; string(text) != want {
+		t.Errorf("json = %s, want %s", text, want)
+	}
+	var parsed StoreID
+	if err := json.Unmarshal(text, &parsed); err != nil || parsed != store.StoreID {
+		t.Errorf("json round trip = %s, %v; want %s", parsed.Hex(), err, oid.Hex())
+	}
+}
@@ -0,0 +1,127 @@
+package notification
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+)
+
+// Dispatcher renders order events into messages and delivers them in the
+// background so request handlers never wait on a notifier.
+type Dispatcher struct {
+	notifier Notifier
+	queue    chan Message
+	done     chan struct{}
+}
+
+func NewDispatcher(notifier Notifier, size int) *Dispatcher {
+	d := &Dispatcher{
+		notifier: notifier,
+		queue:    make(chan Message, size),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	for msg := range d.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := d.notifier.Notify(ctx, msg); err != nil {
+			log.Printf("notification: failed to send %s to %s %s: %v", msg.Event, msg.To.Role, msg.To.ID, err)
+		}
+		cancel()
+	}
+}
+
+// Close stops accepting messages and waits for the queue to drain.
+func (d *Dispatcher) Close() {
+	close(d.queue)
+	<-d.done
+}
+
+// Enqueue schedules a message for delivery. Messages are dropped, and logged,
+// when the queue is full.
+func (d *Dispatcher) Enqueue(msg Message) {
+	select {
+	case d.queue <- msg:
+	default:
+		log.Printf("notification: queue full, dropping %s to %s %s", msg.Event, msg.To.Role, msg.To.ID)
+	}
+}
+
+// OrderTransitioned is a lifecycle.Listener that notifies everyone involved
+// in an order about its new status.
+func (d *Dispatcher) OrderTransitioned(order models.Order, change models.StatusChange) {
+	d.send(change.To, order, Data{Reason: change.Reason})
+}
+
+// SendOTP delivers a pickup or delivery OTP to whoever has to present it.
+func (d *Dispatcher) SendOTP(event string, order models.Order, code string) {
+	d.send(event, order, Data{OTP: code})
+}
+
+// OfferOrder tells delivery agents that an order is waiting for pickup.
+func (d *Dispatcher) OfferOrder(order models.Order, agentIDs ...string) {
+	for _, t := range templates[EventOrderOffered] {
+		body, err := render(t, orderData(order, Data{}))
+		if err != nil {
+			log.Printf("notification: failed to render %s: %v", EventOrderOffered, err)
+			return
+		}
+		for _, id := range agentIDs {
+			to := Recipient{Role: string(t.role), ID: id}
+			d.Enqueue(Message{Channel: t.channel, To: to, Event: EventOrderOffered, Subject: t.subject, Body: body})
+		}
+	}
+}
+
+func (d *Dispatcher) send(event string, order models.Order, data Data) {
+	data = orderData(order, data)
+
+	for _, t := range templates[event] {
+		to := recipient(t.role, order)
+		if to.ID == "" {
+			continue
+		}
+
+		body, err := render(t, data)
+		if err != nil {
+			log.Printf("notification: failed to render %s: %v", event, err)
+			continue
+		}
+
+		d.Enqueue(Message{Channel: t.channel, To: to, Event: event, Subject: t.subject, Body: body})
+	}
+}
+
+// orderData fills in the order details templates can refer to.
+func orderData(order models.Order, data Data) Data {
+	data.OrderID = order.OrderID.Hex()
+	data.Status = order.Status
+	data.Total = strconv.FormatFloat(order.TotalAmount, 'f', 2, 64)
+	return data
+}
+
+// recipient resolves who in the order plays role.
+func recipient(role lifecycle.Role, order models.Order) Recipient {
+	to := Recipient{Role: string(role)}
+	switch role {
+	case lifecycle.Customer:
+		to.ID = strconv.FormatUint(uint64(order.UserID), 10)
+	case lifecycle.Merchant:
+		if !order.StoreID.IsZero() {
+			to.ID = order.StoreID.Hex()
+		}
+	case lifecycle.DeliveryAgent:
+		if order.DeliveryInfo.DeliveryAgentID != 0 {
+			to.ID = strconv.FormatUint(uint64(order.DeliveryInfo.DeliveryAgentID), 10)
+		}
+	}
+	return to
+}
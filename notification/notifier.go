@@ -0,0 +1,56 @@
+package notification
+
+import (
+	"context"
+	"io"
+	"log"
+	"sync"
+)
+
+// Channel is the medium a message is delivered over.
+type Channel string
+
+const (
+	SMS   Channel = "sms"
+	Email Channel = "email"
+	Push  Channel = "push"
+)
+
+// Recipient identifies who a message is for. Role matches the session
+// user_type; ID is the user ID, or the store ID for merchants.
+type Recipient struct {
+	Role string
+	ID   string
+}
+
+// Message is a rendered notification ready to be delivered.
+type Message struct {
+	Channel Channel
+	To      Recipient
+	Event   string
+	Subject string
+	Body    string
+}
+
+// Notifier delivers messages to their recipients.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// LogNotifier writes every message to a log instead of delivering it. It is
+// meant for local development.
+type LogNotifier struct {
+	mu     sync.Mutex
+	logger *log.Logger
+}
+
+func NewLogNotifier(w io.Writer) *LogNotifier {
+	return &LogNotifier{logger: log.New(w, "notification ", log.LstdFlags|log.LUTC)}
+}
+
+func (n *LogNotifier) Notify(_ context.Context, msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.logger.Printf("%s to %s %s [%s] %s: %s", msg.Channel, msg.To.Role, msg.To.ID, msg.Event, msg.Subject, msg.Body)
+	return nil
+}
@@ -0,0 +1,88 @@
+package notification
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+)
+
+// Events that are not status changes.
+const (
+	EventPickupOTP    = "otp.pickup"
+	EventDeliveryOTP  = "otp.delivery"
+	EventOrderOffered = "order.offered"
+)
+
+// Data is what message templates are rendered with.
+type Data struct {
+	OrderID string
+	Status  string
+	Total   string
+	OTP     string
+	Reason  string
+}
+
+type messageTemplate struct {
+	role    lifecycle.Role
+	channel Channel
+	subject string
+	body    *template.Template
+}
+
+func tmpl(role lifecycle.Role, channel Channel, subject, body string) messageTemplate {
+	return messageTemplate{
+		role:    role,
+		channel: channel,
+		subject: subject,
+		body:    template.Must(template.New(subject).Parse(body)),
+	}
+}
+
+// templates lists, per event, the messages sent and who they go to. Status
+// changes use the new status as the event name.
+var templates = map[string][]messageTemplate{
+	lifecycle.Paid: {
+		tmpl(lifecycle.Customer, Push, "Order placed", "We received your payment of {{.Total}} for order {{.OrderID}}."),
+		tmpl(lifecycle.Merchant, Push, "New order", "Order {{.OrderID}} for {{.Total}} is waiting for confirmation."),
+	},
+	lifecycle.Confirmed: {
+		tmpl(lifecycle.Customer, Push, "Order confirmed", "The store confirmed order {{.OrderID}} and is preparing it."),
+	},
+	lifecycle.Ready: {
+		tmpl(lifecycle.Customer, Push, "Order ready", "Order {{.OrderID}} is packed and waiting for a delivery agent."),
+	},
+	lifecycle.Assigned: {
+		tmpl(lifecycle.Customer, Push, "Agent assigned", "A delivery agent is on the way to pick up order {{.OrderID}}."),
+		tmpl(lifecycle.Merchant, Push, "Agent assigned", "A delivery agent accepted order {{.OrderID}}."),
+	},
+	lifecycle.InTransit: {
+		tmpl(lifecycle.Customer, Push, "Order on the way", "Order {{.OrderID}} has been picked up and is on its way."),
+	},
+	lifecycle.Delivered: {
+		tmpl(lifecycle.Customer, Email, "Order delivered", "Order {{.OrderID}} was delivered. Total paid: {{.Total}}."),
+		tmpl(lifecycle.Merchant, Push, "Order delivered", "Order {{.OrderID}} was delivered."),
+	},
+	lifecycle.Cancelled: {
+		tmpl(lifecycle.Customer, Email, "Order cancelled", "Order {{.OrderID}} was cancelled.{{if .Reason}} Reason: {{.Reason}}.{{end}}"),
+		tmpl(lifecycle.Merchant, Push, "Order cancelled", "Order {{.OrderID}} was cancelled.{{if .Reason}} Reason: {{.Reason}}.{{end}}"),
+		tmpl(lifecycle.DeliveryAgent, Push, "Order cancelled", "Order {{.OrderID}} was cancelled, do not pick it up."),
+	},
+	EventOrderOffered: {
+		tmpl(lifecycle.DeliveryAgent, Push, "New delivery", "Order {{.OrderID}} is ready for pickup. Accept it before someone else does."),
+	},
+	EventPickupOTP: {
+		tmpl(lifecycle.DeliveryAgent, SMS, "Pickup OTP", "Show OTP {{.OTP}} at the store to collect order {{.OrderID}}."),
+	},
+	EventDeliveryOTP: {
+		tmpl(lifecycle.Customer, SMS, "Delivery OTP", "Share OTP {{.OTP}} with the delivery agent to receive order {{.OrderID}}."),
+	},
+}
+
+func render(t messageTemplate, data Data) (string, error) {
+	var body strings.Builder
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", err
+	}
+	return body.String(), nil
+}
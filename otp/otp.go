@@ -0,0 +1,92 @@
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+)
+
+// Purposes an OTP can be issued for. An OTP only verifies for the purpose it
+// was issued for.
+const (
+	Pickup   = "pickup"
+	Delivery = "delivery"
+)
+
+const digits = 6
+
+var (
+	ErrMissing = errors.New("no OTP has been issued")
+	ErrExpired = errors.New("OTP has expired")
+	ErrLocked  = errors.New("too many failed OTP attempts")
+	ErrInvalid = errors.New("invalid OTP")
+)
+
+// Issuer creates and checks one time passwords for order handoffs. Only a
+// keyed hash of each code is ever stored.
+type Issuer struct {
+	secret      []byte
+	ttl         time.Duration
+	maxAttempts int
+}
+
+func NewIssuer(secret string, ttl time.Duration, maxAttempts int) *Issuer {
+	return &Issuer{secret: []byte(secret), ttl: ttl, maxAttempts: maxAttempts}
+}
+
+// Issue generates a new code and returns it along with the record to store on
+// the order.
+func (i *Issuer) Issue(purpose string) (string, models.OTP, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", models.OTP{}, err
+	}
+	code := fmt.Sprintf("%0*d", digits, n.Int64())
+
+	return code, models.OTP{
+		Hash:      i.hash(purpose, code),
+		ExpiresAt: time.Now().UTC().Add(i.ttl),
+	}, nil
+}
+
+// MaxAttempts is how many codes may be tried against an OTP before it locks.
+func (i *Issuer) MaxAttempts() int {
+	return i.maxAttempts
+}
+
+// Check verifies code against the stored record as it was before this
+// attempt. The caller counts the attempt before checking, so that parallel
+// guesses are limited too.
+func (i *Issuer) Check(purpose string, stored *models.OTP, code string) error {
+	switch {
+	case stored == nil:
+		return ErrMissing
+	case stored.Attempts >= i.maxAttempts:
+		return ErrLocked
+	case time.Now().After(stored.ExpiresAt):
+		return ErrExpired
+	}
+
+	expected, err := hex.DecodeString(stored.Hash)
+	if err != nil || !hmac.Equal(expected, i.sum(purpose, code)) {
+		return ErrInvalid
+	}
+	return nil
+}
+
+func (i *Issuer) hash(purpose, code string) string {
+	return hex.EncodeToString(i.sum(purpose, code))
+}
+
+func (i *Issuer) sum(purpose, code string) []byte {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(purpose + "|" + code))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,60 @@
+package otp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+)
+
+func TestCheck(t *testing.T) {
+	issuer := NewIssuer("secret", time.Minute, 3)
+	code, record, err := issuer.Issue(Pickup)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if len(code) != digits || record.Attempts != 0 {
+		t.Fatalf("Issue = %q with %d attempts, want %d digits and none", code, record.Attempts, digits)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	withAttempts := func(n int) *models.OTP {
+		r := record
+		r.Attempts = n
+		return &r
+	}
+	expired := record
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+
+	tests := []struct {
+		name    string
+		purpose string
+		stored  *models.OTP
+		code    string
+		want    error
+	}{
+		{"right code", Pickup, &record, code, nil},
+		{"right code after failed attempts", Pickup, withAttempts(2), code, nil},
+		{"wrong code", Pickup, &record, wrong, ErrInvalid},
+		{"other purpose", Delivery, &record, code, ErrInvalid},
+		{"expired", Pickup, &expired, code, ErrExpired},
+		{"locked", Pickup, withAttempts(3), code, ErrLocked},
+		{"not issued", Pickup, nil, code, ErrMissing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := issuer.Check(tt.purpose, tt.stored, tt.code); !errors.Is(err, tt.want) {
+				t.Errorf("Check = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	other := NewIssuer("other secret", time.Minute, 3)
+	if err := other.Check(Pickup, &record, code); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Check with another secret = %v, want %v", err, ErrInvalid)
+	}
+}
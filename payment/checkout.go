@@ -0,0 +1,23 @@
+package payment
+
+import (
+	_ "embed"
+	"html/template"
+)
+
+//go:embed checkout.html
+var checkoutHTML string
+
+// CheckoutPage renders the hosted checkout for a pending order.
+var CheckoutPage = template.Must(template.New("checkout").Parse(checkoutHTML))
+
+// CheckoutData is the data CheckoutPage is rendered with.
+type CheckoutData struct {
+	KeyID          string
+	GatewayOrderID string
+	Amount         int64
+	Display        string
+	Currency       string
+	SuccessURL     string
+	FailureURL     string
+}
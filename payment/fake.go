@@ -0,0 +1,77 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// Fake is an in-memory gateway for local runs and tests. Signatures use the
+// same scheme as Razorpay with a secret generated for each Fake, so only Sign
+// and SignWebhook can produce valid callbacks.
+type Fake struct {
+	secret string
+
+	mu   sync.Mutex
+	next int
+}
+
+func NewFake() (*Fake, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return &Fake{secret: hex.EncodeToString(secret)}, nil
+}
+
+func (f *Fake) KeyID() string {
+	return "fake_key"
+}
+
+func (f *Fake) CreateOrder(_ context.Context, amount int64, receipt string) (Order, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	return Order{
+		ID:       fmt.Sprintf("order_fake_%d", f.next),
+		Amount:   amount,
+		Currency: Currency,
+		Receipt:  receipt,
+		Status:   StatusCreated,
+	}, nil
+}
+
+// Refund settles every refund immediately.
+func (f *Fake) Refund(_ context.Context, paymentID string, amount int64) (Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	return Refund{
+		ID:        fmt.Sprintf("rfnd_fake_%d", f.next),
+		PaymentID: paymentID,
+		Amount:    amount,
+		Status:    RefundProcessed,
+	}, nil
+}
+
+func (f *Fake) VerifyPaymentSignature(orderID, paymentID, signature string) error {
+	return verifyHMAC(f.secret, []byte(orderID+"|"+paymentID), signature)
+}
+
+func (f *Fake) VerifyWebhookSignature(body []byte, signature string) error {
+	return verifyHMAC(f.secret, body, signature)
+}
+
+// Sign returns the signature the checkout would return for a payment.
+func (f *Fake) Sign(orderID, paymentID string) string {
+	return sign(f.secret, []byte(orderID+"|"+paymentID))
+}
+
+// SignWebhook returns the signature the provider would send with body.
+func (f *Fake) SignWebhook(body []byte) string {
+	return sign(f.secret, body)
+}
@@ -0,0 +1,61 @@
+package payment
+
+import (
+	"context"
+	"math"
+)
+
+// Currency is the currency every order is charged in.
+const Currency = "INR"
+
+// Gateway order and payment statuses.
+const (
+	StatusCreated = "created"
+	StatusPaid    = "paid"
+	StatusFailed  = "failed"
+)
+
+// Refund statuses tracked on an order.
+const (
+	RefundInitiated = "initiated"
+	RefundProcessed = "processed"
+	RefundFailed    = "failed"
+)
+
+// Order is an order created with the payment gateway. Amounts are in currency
+// subunits (paise).
+type Order struct {
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Receipt  string `json:"receipt"`
+	Status   string `json:"status"`
+}
+
+// Refund is a refund issued against a captured payment.
+type Refund struct {
+	ID        string `json:"id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Status    string `json:"status"`
+}
+
+// Gateway is a payment provider the service collects order payments through.
+type Gateway interface {
+	// KeyID is the public key the checkout page uses to talk to the provider.
+	KeyID() string
+	// CreateOrder registers an amount to be collected, identified by receipt.
+	CreateOrder(ctx context.Context, amount int64, receipt string) (Order, error)
+	// Refund returns amount of a captured payment to the customer.
+	Refund(ctx context.Context, paymentID string, amount int64) (Refund, error)
+	// VerifyPaymentSignature checks the signature the checkout returns for a
+	// successful payment of a gateway order.
+	VerifyPaymentSignature(orderID, paymentID, signature string) error
+	// VerifyWebhookSignature checks the signature sent with a webhook body.
+	VerifyWebhookSignature(body []byte, signature string) error
+}
+
+// Subunits converts an amount in rupees to paise.
+func Subunits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
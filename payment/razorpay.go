@@ -0,0 +1,115 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const razorpayBaseURL = "https://api.razorpay.com/v1"
+
+// Razorpay talks to the Razorpay orders API.
+type Razorpay struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	client        *http.Client
+}
+
+// NewRazorpay returns ErrMissingSecret unless every credential is set, since
+// signatures made with an empty secret can be forged.
+func NewRazorpay(keyID, keySecret, webhookSecret string) (*Razorpay, error) {
+	if keyID == "" || keySecret == "" || webhookSecret == "" {
+		return nil, ErrMissingSecret
+	}
+	return &Razorpay{
+		keyID:         keyID,
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (r *Razorpay) KeyID() string {
+	return r.keyID
+}
+
+func (r *Razorpay) CreateOrder(ctx context.Context, amount int64, receipt string) (Order, error) {
+	body := map[string]interface{}{
+		"amount":   amount,
+		"currency": Currency,
+		"receipt":  receipt,
+	}
+
+	var order Order
+	err := r.do(ctx, http.MethodPost, "/orders", body, &order)
+	return order, err
+}
+
+func (r *Razorpay) Refund(ctx context.Context, paymentID string, amount int64) (Refund, error) {
+	body := map[string]interface{}{"amount": amount}
+
+	var refund Refund
+	if err := r.do(ctx, http.MethodPost, "/payments/"+paymentID+"/refund", body, &refund); err != nil {
+		return refund, err
+	}
+
+	// Razorpay reports refunds in flight as pending
+	if refund.Status == "pending" {
+		refund.Status = RefundInitiated
+	}
+	return refund, nil
+}
+
+// VerifyPaymentSignature checks the HMAC-SHA256 of "order_id|payment_id"
+// signed with the key secret.
+func (r *Razorpay) VerifyPaymentSignature(orderID, paymentID, signature string) error {
+	return verifyHMAC(r.keySecret, []byte(orderID+"|"+paymentID), signature)
+}
+
+// VerifyWebhookSignature checks the HMAC-SHA256 of the raw body signed with
+// the webhook secret.
+func (r *Razorpay) VerifyWebhookSignature(body []byte, signature string) error {
+	return verifyHMAC(r.webhookSecret, body, signature)
+}
+
+// razorpayError is the error envelope returned by the Razorpay API.
+type razorpayError struct {
+	Error struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+func (r *Razorpay) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, razorpayBaseURL+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.keyID, r.keySecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr razorpayError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("razorpay: %s %s: %d %s %s", method, path, resp.StatusCode, apiErr.Error.Code, apiErr.Error.Description)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
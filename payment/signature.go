@@ -0,0 +1,40 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid payment signature")
+	ErrMissingSecret    = errors.New("razorpay key ID, key secret and webhook secret are required")
+)
+
+// verifyHMAC checks that signature is the hex encoded HMAC-SHA256 of message.
+func verifyHMAC(secret string, message []byte, signature string) error {
+	// Anyone can sign with an empty key
+	if secret == "" {
+		return ErrInvalidSignature
+	}
+
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of message.
+func sign(secret string, message []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
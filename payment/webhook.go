@@ -0,0 +1,39 @@
+package payment
+
+// Webhook event names the service acts on.
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+	EventRefundProcessed = "refund.processed"
+	EventRefundFailed    = "refund.failed"
+)
+
+// WebhookEvent is the body of a provider webhook call.
+type WebhookEvent struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity PaymentEntity `json:"entity"`
+		} `json:"payment"`
+		Refund struct {
+			Entity RefundEntity `json:"entity"`
+		} `json:"refund"`
+	} `json:"payload"`
+}
+
+// PaymentEntity is a payment as reported by the provider.
+type PaymentEntity struct {
+	ID               string `json:"id"`
+	OrderID          string `json:"order_id"`
+	Amount           int64  `json:"amount"`
+	Status           string `json:"status"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// RefundEntity is a refund as reported by the provider.
+type RefundEntity struct {
+	ID        string `json:"id"`
+	PaymentID string `json:"payment_id"`
+	Amount    int64  `json:"amount"`
+	Status    string `json:"status"`
+}
@@ -0,0 +1,766 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/catalog"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryOrders keeps orders in a map. Orders are copied through BSON on the
+// way in and out, so callers never share state with the store and times have
+// MongoDB's precision.
+type MemoryOrders struct {
+	mu     sync.Mutex
+	orders map[primitive.ObjectID]models.Order
+}
+
+func NewMemoryOrders(orders ...models.Order) *MemoryOrders {
+	r := &MemoryOrders{orders: make(map[primitive.ObjectID]models.Order)}
+	for _, order := range orders {
+		r.orders[order.OrderID] = clone(order)
+	}
+	return r
+}
+
+// matches reports whether order is within scope.
+func (s Scope) matches(order models.Order) bool {
+	if s.UserID != nil && order.UserID != *s.UserID {
+		return false
+	}
+	if s.StoreID != nil && order.StoreID != *s.StoreID {
+		return false
+	}
+	if s.AgentID != nil && order.DeliveryInfo.DeliveryAgentID != *s.AgentID {
+		return false
+	}
+	if s.Unassigned && order.DeliveryInfo.DeliveryAgentID != 0 {
+		return false
+	}
+	return true
+}
+
+func (r *MemoryOrders) Get(_ context.Context, id primitive.ObjectID, scope Scope) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok || !scope.matches(order) {
+		return models.Order{}, ErrNotFound
+	}
+	return clone(order), nil
+}
+
+func (r *MemoryOrders) GetByGatewayOrder(_ context.Context, gatewayOrderID string) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, order := range r.orders {
+		if order.Payment.GatewayOrderID == gatewayOrderID {
+			return clone(order), nil
+		}
+	}
+	return models.Order{}, ErrNotFound
+}
+
+// list returns the orders keep selects, newest first.
+func (r *MemoryOrders) list(keep func(models.Order) bool) []models.Order {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	orders := []models.Order{}
+	for _, order := range r.orders {
+		if keep(order) {
+			orders = append(orders, clone(order))
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+	return orders
+}
+
+func (r *MemoryOrders) ListByUser(_ context.Context, userID models.UserID) ([]models.Order, error) {
+	return r.list(func(order models.Order) bool { return order.UserID == userID }), nil
+}
+
+func (r *MemoryOrders) ListByStore(_ context.Context, storeID models.StoreID) ([]models.Order, error) {
+	return r.list(func(order models.Order) bool { return order.StoreID == storeID }), nil
+}
+
+func (r *MemoryOrders) ListByAgent(_ context.Context, agentID models.AgentID) ([]models.Order, error) {
+	return r.list(func(order models.Order) bool { return order.DeliveryInfo.DeliveryAgentID == agentID }), nil
+}
+
+func (r *MemoryOrders) ListOpen(_ context.Context) ([]models.Order, error) {
+	orders := r.list(func(order models.Order) bool {
+		return order.Status == lifecycle.Ready && order.DeliveryInfo.DeliveryAgentID == 0
+	})
+	sort.Slice(orders, func(i, j int) bool { return orders[i].UpdatedAt.Before(orders[j].UpdatedAt) })
+	return orders, nil
+}
+
+func (r *MemoryOrders) CountCarrying(_ context.Context, agentIDs ...models.AgentID) (map[models.AgentID]int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	counts := make(map[models.AgentID]int)
+	for _, order := range r.orders {
+		if order.Status != lifecycle.Assigned && order.Status != lifecycle.InTransit {
+			continue
+		}
+		for _, id := range agentIDs {
+			if order.DeliveryInfo.DeliveryAgentID == id {
+				counts[id]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (r *MemoryOrders) Insert(_ context.Context, order models.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if order.OrderID.IsZero() {
+		order.OrderID = primitive.NewObjectID()
+	}
+	r.orders[order.OrderID] = clone(order)
+	return nil
+}
+
+// Transition checks the move against the order as it was read and only
+// stores it if the order is still in that status, like MongoOrders; a
+// concurrent move in between returns lifecycle.ErrConflict.
+func (r *MemoryOrders) Transition(ctx context.Context, id primitive.ObjectID, scope Scope, t lifecycle.Transition) (models.Order, error) {
+	order, err := r.Get(ctx, id, scope)
+	if err != nil {
+		return models.Order{}, lifecycle.ErrNotFound
+	}
+
+	if err := lifecycle.Check(order.Status, t.To, t.By); err != nil {
+		return order, err
+	}
+	if t.Guard != nil {
+		if err := t.Guard(order); err != nil {
+			return order, err
+		}
+	}
+
+	r.mu.Lock()
+	current, ok := r.orders[id]
+	if !ok || current.Status != order.Status {
+		r.mu.Unlock()
+		return order, lifecycle.ErrConflict
+	}
+	current = clone(current)
+
+	change := t.Change(current.Status)
+	current.Status = t.To
+	current.UpdatedAt = change.At
+	current.History = append(current.History, change)
+	current, err = setFields(current, t.Set)
+	if err != nil {
+		r.mu.Unlock()
+		return current, err
+	}
+	// The order is only stored if every recorder succeeds, as in a transaction
+	if err := lifecycle.Recorded(ctx, clone(current), change); err != nil {
+		r.mu.Unlock()
+		return current, err
+	}
+	r.orders[id] = current
+	r.mu.Unlock()
+
+	updated := clone(current)
+	lifecycle.Notify(updated, change)
+	return updated, nil
+}
+
+func (r *MemoryOrders) Adjust(_ context.Context, order models.Order, adjustment models.Adjustment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.orders[order.OrderID]
+	if !ok || stored.Status != order.Status || !stored.UpdatedAt.Equal(order.UpdatedAt) {
+		return lifecycle.ErrConflict
+	}
+
+	stored.Items = order.Items
+	stored.TotalAmount = order.TotalAmount
+	stored.Payment.Amount = order.Payment.Amount
+	stored.UpdatedAt = adjustment.At
+	stored.Adjustments = append(stored.Adjustments, adjustment)
+	r.orders[order.OrderID] = clone(stored)
+	return nil
+}
+
+func (r *MemoryOrders) SetPayment(_ context.Context, id primitive.ObjectID, info models.PaymentInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok || order.Status != lifecycle.PendingPayment || order.Payment.GatewayOrderID != "" {
+		return ErrNotFound
+	}
+	order.Payment = info
+	order.UpdatedAt = time.Now().UTC()
+	r.orders[id] = clone(order)
+	return nil
+}
+
+func (r *MemoryOrders) MarkPaymentFailed(_ context.Context, gatewayOrderID, paymentID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, order := range r.orders {
+		if order.Payment.GatewayOrderID != gatewayOrderID || order.Status != lifecycle.PendingPayment {
+			continue
+		}
+		order.Payment.Status = payment.StatusFailed
+		order.Payment.PaymentID = paymentID
+		order.UpdatedAt = time.Now().UTC()
+		r.orders[id] = clone(order)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *MemoryOrders) AddRefund(_ context.Context, id primitive.ObjectID, refund models.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return ErrNotFound
+	}
+	order.Refunds = append(order.Refunds, refund)
+	order.UpdatedAt = refund.CreatedAt
+	r.orders[id] = clone(order)
+	return nil
+}
+
+func (r *MemoryOrders) SetRefundStatus(_ context.Context, refundID, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now().UTC()
+	for id, order := range r.orders {
+		for i := range order.Refunds {
+			if order.Refunds[i].RefundID != refundID {
+				continue
+			}
+			order.Refunds[i].Status = status
+			order.Refunds[i].UpdatedAt = now
+			order.UpdatedAt = now
+			r.orders[id] = clone(order)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *MemoryOrders) ListFailedRefunds(_ context.Context) ([]models.Order, error) {
+	orders := r.list(func(order models.Order) bool {
+		for _, refund := range order.Refunds {
+			if refund.Status == payment.RefundFailed {
+				return true
+			}
+		}
+		return false
+	})
+	sort.Slice(orders, func(i, j int) bool { return orders[i].CreatedAt.Before(orders[j].CreatedAt) })
+	return orders, nil
+}
+
+func (r *MemoryOrders) UpdateRefund(_ context.Context, id, refundID primitive.ObjectID, from, gatewayRefundID, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return ErrNotFound
+	}
+	for i := range order.Refunds {
+		if order.Refunds[i].ID != refundID || order.Refunds[i].Status != from {
+			continue
+		}
+		now := time.Now().UTC()
+		order.Refunds[i].RefundID = gatewayRefundID
+		order.Refunds[i].Status = status
+		order.Refunds[i].UpdatedAt = now
+		order.UpdatedAt = now
+		r.orders[id] = clone(order)
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (r *MemoryOrders) AttemptOTP(_ context.Context, id primitive.ObjectID, purpose string, maxAttempts int) (models.OTP, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return models.OTP{}, otp.ErrMissing
+	}
+	order = clone(order)
+	stored := order.PickupOTP
+	if purpose == otp.Delivery {
+		stored = order.DeliveryOTP
+	}
+	if stored == nil {
+		return models.OTP{}, otp.ErrMissing
+	}
+	if stored.Attempts >= maxAttempts {
+		return models.OTP{}, otp.ErrLocked
+	}
+
+	before := *stored
+	stored.Attempts++
+	r.orders[id] = order
+	return before, nil
+}
+
+func (r *MemoryOrders) ReplaceOTP(_ context.Context, id primitive.ObjectID, scope Scope, status, purpose string, record models.OTP) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok || !scope.matches(order) || order.Status != status {
+		return models.Order{}, ErrNotFound
+	}
+	order = clone(order)
+	if purpose == otp.Delivery {
+		order.DeliveryOTP = &record
+	} else {
+		order.PickupOTP = &record
+	}
+	order.UpdatedAt = time.Now().UTC()
+	r.orders[id] = order
+	return clone(order), nil
+}
+
+func (r *MemoryOrders) SetLocation(_ context.Context, id primitive.ObjectID, location models.Location) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	order, ok := r.orders[id]
+	if !ok {
+		return false, nil
+	}
+	if last := order.DeliveryInfo.LastLocation; last != nil && !last.RecordedAt.Before(location.RecordedAt) {
+		return false, nil
+	}
+	order.DeliveryInfo.LastLocation = &location
+	r.orders[id] = clone(order)
+	return true, nil
+}
+
+// MemoryCarts keeps one cart per user in a map.
+type MemoryCarts struct {
+	mu    sync.Mutex
+	carts map[models.UserID]models.Order
+}
+
+func NewMemoryCarts() *MemoryCarts {
+	return &MemoryCarts{carts: make(map[models.UserID]models.Order)}
+}
+
+func (r *MemoryCarts) Get(_ context.Context, userID models.UserID) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cart, ok := r.carts[userID]
+	if !ok {
+		return cart, ErrNotFound
+	}
+	return clone(cart), nil
+}
+
+// put stores the cart, creating it on first use, and returns a copy.
+func (r *MemoryCarts) put(userID models.UserID, cart models.Order, now time.Time) models.Order {
+	if cart.OrderID.IsZero() {
+		cart.OrderID = primitive.NewObjectID()
+		cart.CreatedAt = now
+	}
+	cart.UserID = userID
+	cart.UpdatedAt = now
+	r.carts[userID] = clone(cart)
+	return clone(cart)
+}
+
+func (r *MemoryCarts) Upsert(_ context.Context, userID models.UserID, cart models.Order) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored := r.carts[userID]
+	stored.StoreID = cart.StoreID
+	stored.Items = cart.Items
+	return r.put(userID, withTotals(stored), time.Now().UTC()), nil
+}
+
+func (r *MemoryCarts) AddItem(_ context.Context, userID models.UserID, storeID models.StoreID, line models.OrderItem, replace bool) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cart := r.carts[userID]
+
+	switch {
+	case replace || len(cart.Items) == 0:
+		cart.StoreID = storeID
+		cart.Items = []models.OrderItem{line}
+	case cart.StoreID != storeID:
+		return models.Order{}, ErrOtherStore
+	default:
+		found := false
+		for i := range cart.Items {
+			if cart.Items[i].ItemID == line.ItemID {
+				cart.Items[i].Quantity += line.Quantity
+				found = true
+			}
+		}
+		if !found {
+			cart.Items = append(cart.Items, line)
+		}
+	}
+
+	return r.put(userID, withTotals(cart), time.Now().UTC()), nil
+}
+
+func (r *MemoryCarts) SetQuantity(_ context.Context, userID models.UserID, itemID primitive.ObjectID, quantity int) (models.Order, error) {
+	return r.updateItem(userID, itemID, func(items []models.OrderItem, i int) []models.OrderItem {
+		items[i].Quantity = quantity
+		return items
+	})
+}
+
+func (r *MemoryCarts) RemoveItem(_ context.Context, userID models.UserID, itemID primitive.ObjectID) (models.Order, error) {
+	return r.updateItem(userID, itemID, func(items []models.OrderItem, i int) []models.OrderItem {
+		return append(items[:i], items[i+1:]...)
+	})
+}
+
+func (r *MemoryCarts) updateItem(userID models.UserID, itemID primitive.ObjectID, update func(items []models.OrderItem, i int) []models.OrderItem) (models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cart, ok := r.carts[userID]
+	if !ok {
+		return models.Order{}, ErrNotFound
+	}
+	for i := range cart.Items {
+		if cart.Items[i].ItemID == itemID {
+			cart.Items = update(cart.Items, i)
+			return r.put(userID, withTotals(cart), time.Now().UTC()), nil
+		}
+	}
+	return models.Order{}, ErrNotFound
+}
+
+func (r *MemoryCarts) Clear(_ context.Context, userID models.UserID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.carts, userID)
+	return nil
+}
+
+func (r *MemoryCarts) Delete(_ context.Context, userID models.UserID, cartID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cart, ok := r.carts[userID]
+	if !ok || cart.OrderID != cartID {
+		return ErrNotFound
+	}
+	delete(r.carts, userID)
+	return nil
+}
+
+func (r *MemoryCarts) ListAbandoned(_ context.Context, before time.Time) ([]models.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	carts := []models.Order{}
+	for _, cart := range r.carts {
+		if len(cart.Items) > 0 && cart.UpdatedAt.Before(before) {
+			carts = append(carts, clone(cart))
+		}
+	}
+	sort.Slice(carts, func(i, j int) bool { return carts[i].UpdatedAt.Before(carts[j].UpdatedAt) })
+	return carts, nil
+}
+
+// MemoryStores keeps the merchant to store mapping in a map. Put registers
+// stores.
+type MemoryStores struct {
+	mu     sync.RWMutex
+	stores map[models.MerchantID]models.Store
+}
+
+func NewMemoryStores(stores ...models.Store) *MemoryStores {
+	r := &MemoryStores{stores: make(map[models.MerchantID]models.Store)}
+	for _, store := range stores {
+		r.Put(store)
+	}
+	return r
+}
+
+// Put adds or replaces the store of a merchant.
+func (r *MemoryStores) Put(store models.Store) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stores[store.MerchantID] = store
+}
+
+func (r *MemoryStores) ForMerchant(_ context.Context, merchantID models.MerchantID) (models.Store, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	store, ok := r.stores[merchantID]
+	if !ok {
+		return store, ErrNoStore
+	}
+	return store, nil
+}
+
+// MemoryAgents keeps delivery agent availability in a map.
+type MemoryAgents struct {
+	mu     sync.Mutex
+	agents map[models.AgentID]models.Agent
+}
+
+func NewMemoryAgents() *MemoryAgents {
+	return &MemoryAgents{agents: make(map[models.AgentID]models.Agent)}
+}
+
+func (r *MemoryAgents) Get(_ context.Context, agentID models.AgentID) (models.Agent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	agent, ok := r.agents[agentID]
+	if !ok {
+		return agent, ErrNotFound
+	}
+	return agent, nil
+}
+
+func (r *MemoryAgents) GoOnline(_ context.Context, agentID models.AgentID, capacity, defaultCapacity int, at time.Time) (models.Agent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	agent, ok := r.agents[agentID]
+	if !ok {
+		agent = models.Agent{AgentID: agentID, Capacity: defaultCapacity}
+	}
+	if !agent.Online {
+		agent.ShiftStartedAt = &at
+	}
+	if capacity > 0 {
+		agent.Capacity = capacity
+	}
+	agent.Online = true
+	agent.LastSeenAt = at
+	r.agents[agentID] = agent
+	return agent, nil
+}
+
+func (r *MemoryAgents) GoOffline(_ context.Context, agentID models.AgentID, at time.Time) (models.Agent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	agent, ok := r.agents[agentID]
+	if !ok {
+		return agent, ErrNotFound
+	}
+	agent.Online = false
+	agent.ShiftStartedAt = nil
+	agent.LastSeenAt = at
+	r.agents[agentID] = agent
+	return agent, nil
+}
+
+func (r *MemoryAgents) ListOnline(_ context.Context) ([]models.Agent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	agents := []models.Agent{}
+	for _, agent := range r.agents {
+		if agent.Online {
+			agents = append(agents, agent)
+		}
+	}
+	return agents, nil
+}
+
+func (r *MemoryAgents) Hold(_ context.Context, agentID models.AgentID, now, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	agent, ok := r.agents[agentID]
+	if !ok || !agent.Online || (agent.HeldUntil != nil && !agent.HeldUntil.Before(now)) {
+		return ErrNotFound
+	}
+	agent.HeldUntil = &until
+	r.agents[agentID] = agent
+	return nil
+}
+
+func (r *MemoryAgents) Unhold(_ context.Context, agentID models.AgentID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if agent, ok := r.agents[agentID]; ok {
+		agent.HeldUntil = nil
+		r.agents[agentID] = agent
+	}
+	return nil
+}
+
+// MemoryTrail keeps trail points in a slice, in the order they were added.
+type MemoryTrail struct {
+	mu     sync.Mutex
+	points []models.TrailPoint
+}
+
+func NewMemoryTrail() *MemoryTrail {
+	return &MemoryTrail{}
+}
+
+func (r *MemoryTrail) Add(_ context.Context, point models.TrailPoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.points = append(r.points, point)
+	return nil
+}
+
+func (r *MemoryTrail) Recent(_ context.Context, orderID primitive.ObjectID, limit int64) ([]models.TrailPoint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	points := []models.TrailPoint{}
+	for _, point := range r.points {
+		if point.OrderID == orderID {
+			points = append(points, point)
+		}
+	}
+	sort.SliceStable(points, func(i, j int) bool { return points[i].RecordedAt.Before(points[j].RecordedAt) })
+	if int64(len(points)) > limit {
+		points = points[int64(len(points))-limit:]
+	}
+	return points, nil
+}
+
+// MemoryMerchantEvents keeps each store's board events in a slice ordered by
+// sequence number.
+type MemoryMerchantEvents struct {
+	mu     sync.Mutex
+	events map[models.StoreID][]models.MerchantEvent
+}
+
+func NewMemoryMerchantEvents() *MemoryMerchantEvents {
+	return &MemoryMerchantEvents{events: make(map[models.StoreID][]models.MerchantEvent)}
+}
+
+func (r *MemoryMerchantEvents) Append(_ context.Context, event models.MerchantEvent) (models.MerchantEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	event.Seq = int64(len(r.events[event.StoreID])) + 1
+	r.events[event.StoreID] = append(r.events[event.StoreID], event)
+	return event, nil
+}
+
+func (r *MemoryMerchantEvents) Latest(_ context.Context, storeID models.StoreID) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.events[storeID])), nil
+}
+
+func (r *MemoryMerchantEvents) Since(_ context.Context, storeID models.StoreID, seq int64, limit int64) ([]models.MerchantEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := []models.MerchantEvent{}
+	for _, event := range r.events[storeID] {
+		if event.Seq > seq && int64(len(events)) < limit {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// MemoryWebhookEvents keeps the IDs of handled webhook events in a set.
+type MemoryWebhookEvents struct {
+	mu     sync.Mutex
+	events map[string]struct{}
+}
+
+func NewMemoryWebhookEvents() *MemoryWebhookEvents {
+	return &MemoryWebhookEvents{events: make(map[string]struct{})}
+}
+
+func (r *MemoryWebhookEvents) Claim(_ context.Context, id, _ string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.events[id]; ok {
+		return false, nil
+	}
+	r.events[id] = struct{}{}
+	return true, nil
+}
+
+func (r *MemoryWebhookEvents) Release(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.events, id)
+	return nil
+}
+
+// MemoryTransactor runs functions directly. Changes made before a failure
+// are not rolled back.
+type MemoryTransactor struct{}
+
+func (MemoryTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// withTotals recomputes the line totals and total of a cart.
+func withTotals(cart models.Order) models.Order {
+	var total float64
+	for i := range cart.Items {
+		cart.Items[i].LineTotal = catalog.RoundCents(cart.Items[i].Price * float64(cart.Items[i].Quantity))
+		total += cart.Items[i].LineTotal
+	}
+	cart.TotalAmount = catalog.RoundCents(total)
+	return cart
+}
+
+// clone deep copies an order by round-tripping it through BSON. Orders always
+// encode, so a failure is a programming error.
+func clone(order models.Order) models.Order {
+	raw, err := bson.Marshal(order)
+	if err != nil {
+		panic(err)
+	}
+	var copied models.Order
+	if err := bson.Unmarshal(raw, &copied); err != nil {
+		panic(err)
+	}
+	return copied
+}
+
+// setFields applies a $set style update, with dotted paths, to an order.
+func setFields(order models.Order, set bson.M) (models.Order, error) {
+	if len(set) == 0 {
+		return order, nil
+	}
+
+	raw, err := bson.Marshal(order)
+	if err != nil {
+		return order, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return order, err
+	}
+
+	for path, value := range set {
+		fields := strings.Split(path, ".")
+		parent := doc
+		for _, field := range fields[:len(fields)-1] {
+			child, ok := parent[field].(bson.M)
+			if !ok {
+				child = bson.M{}
+				parent[field] = child
+			}
+			parent = child
+		}
+		parent[fields[len(fields)-1]] = value
+	}
+
+	raw, err = bson.Marshal(doc)
+	if err != nil {
+		return order, err
+	}
+	var updated models.Order
+	err = bson.Unmarshal(raw, &updated)
+	return updated, err
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func paidOrder(t *testing.T, orders *MemoryOrders) models.Order {
+	order := models.Order{
+		OrderID:   primitive.NewObjectID(),
+		StoreID:   models.NewStoreID(),
+		UserID:    1,
+		Status:    lifecycle.Paid,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := orders.Insert(context.Background(), order); err != nil {
+		t.Fatalf("insert order: %v", err)
+	}
+	return order
+}
+
+func TestTransitionAppendsHistory(t *testing.T) {
+	orders := NewMemoryOrders()
+	order := paidOrder(t, orders)
+
+	updated, err := orders.Transition(context.Background(), order.OrderID, User(1),
+		lifecycle.Transition{To: lifecycle.Cancelled, By: lifecycle.Customer, ActorID: 1, Reason: "changed my mind"})
+	if err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+
+	stored, _ := orders.Get(context.Background(), order.OrderID, Scope{})
+	for _, got := range []models.Order{updated, stored} {
+		if got.Status != lifecycle.Cancelled || len(got.History) != 1 {
+			t.Fatalf("order is %s with %d history entries, want Cancelled with 1", got.Status, len(got.History))
+		}
+		change := got.History[0]
+		if change.From != lifecycle.Paid || change.ActorType != string(lifecycle.Customer) || change.ActorID != 1 || change.At.IsZero() {
+			t.Errorf("history entry = %+v, want the customer's move from Paid", change)
+		}
+	}
+
+	_, err = orders.Transition(context.Background(), order.OrderID, User(2),
+		lifecycle.Transition{To: lifecycle.Cancelled, By: lifecycle.Customer, ActorID: 2})
+	if !errors.Is(err, lifecycle.ErrNotFound) {
+		t.Errorf("transition outside the scope = %v, want ErrNotFound", err)
+	}
+}
+
+// A move that raced with another one since the order was read must not be
+// stored over it.
+func TestTransitionConflict(t *testing.T) {
+	orders := NewMemoryOrders()
+	order := paidOrder(t, orders)
+
+	_, err := orders.Transition(context.Background(), order.OrderID, Scope{}, lifecycle.Transition{
+		To: lifecycle.Confirmed,
+		By: lifecycle.Merchant,
+		Guard: func(models.Order) error {
+			// The customer cancels after the merchant's move was checked
+			_, err := orders.Transition(context.Background(), order.OrderID, Scope{},
+				lifecycle.Transition{To: lifecycle.Cancelled, By: lifecycle.Customer, ActorID: 1})
+			return err
+		},
+	})
+	if !errors.Is(err, lifecycle.ErrConflict) {
+		t.Fatalf("Transition = %v, want ErrConflict", err)
+	}
+
+	stored, _ := orders.Get(context.Background(), order.OrderID, Scope{})
+	if stored.Status != lifecycle.Cancelled || len(stored.History) != 1 {
+		t.Errorf("order is %s with history %+v, want only the cancellation", stored.Status, stored.History)
+	}
+}
+
+func TestConcurrentTransitionsApplyOnce(t *testing.T) {
+	orders := NewMemoryOrders()
+	order := paidOrder(t, orders)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func(actor uint) {
+			defer wg.Done()
+			_, err := orders.Transition(context.Background(), order.OrderID, Scope{},
+				lifecycle.Transition{To: lifecycle.Cancelled, By: lifecycle.Merchant, ActorID: actor})
+			errs <- err
+		}(uint(i))
+	}
+	wg.Wait()
+	close(errs)
+
+	moved := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			moved++
+		case !errors.Is(err, lifecycle.ErrConflict) && !errors.Is(err, lifecycle.ErrIllegalTransition):
+			t.Errorf("Transition = %v, want ErrConflict or ErrIllegalTransition", err)
+		}
+	}
+	if moved != 1 {
+		t.Errorf("%d transitions were applied, want 1", moved)
+	}
+	if stored, _ := orders.Get(context.Background(), order.OrderID, Scope{}); len(stored.History) != 1 {
+		t.Errorf("history has %d entries, want 1", len(stored.History))
+	}
+}
+
+// Parallel guesses must not get more than maxAttempts codes compared, and
+// a new OTP starts over.
+func TestAttemptOTPLocksParallelGuesses(t *testing.T) {
+	const maxAttempts = 3
+	orders := NewMemoryOrders()
+	order := paidOrder(t, orders)
+	issuer := otp.NewIssuer("secret", time.Minute, maxAttempts)
+
+	code, record, err := issuer.Issue(otp.Pickup)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := orders.ReplaceOTP(context.Background(), order.OrderID, Scope{}, lifecycle.Paid, otp.Pickup, record); err != nil {
+		t.Fatalf("ReplaceOTP: %v", err)
+	}
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stored, err := orders.AttemptOTP(context.Background(), order.OrderID, otp.Pickup, maxAttempts)
+			if err == nil {
+				err = issuer.Check(otp.Pickup, &stored, wrong)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	compared := 0
+	for err := range errs {
+		switch {
+		case errors.Is(err, otp.ErrInvalid):
+			compared++
+		case !errors.Is(err, otp.ErrLocked):
+			t.Errorf("guess = %v, want ErrInvalid or ErrLocked", err)
+		}
+	}
+	if compared != maxAttempts {
+		t.Errorf("%d guesses were compared, want %d", compared, maxAttempts)
+	}
+	if _, err := orders.AttemptOTP(context.Background(), order.OrderID, otp.Pickup, maxAttempts); !errors.Is(err, otp.ErrLocked) {
+		t.Errorf("attempt with the right code after lockout = %v, want ErrLocked", err)
+	}
+
+	// A reissued OTP has no failed attempts
+	code, record, err = issuer.Issue(otp.Pickup)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := orders.ReplaceOTP(context.Background(), order.OrderID, Scope{}, lifecycle.Paid, otp.Pickup, record); err != nil {
+		t.Fatalf("ReplaceOTP: %v", err)
+	}
+	stored, err := orders.AttemptOTP(context.Background(), order.OrderID, otp.Pickup, maxAttempts)
+	if err != nil || stored.Attempts != 0 {
+		t.Fatalf("attempt after reissue = %d attempts, %v; want 0, nil", stored.Attempts, err)
+	}
+	if err := issuer.Check(otp.Pickup, &stored, code); err != nil {
+		t.Errorf("Check after reissue = %v, want nil", err)
+	}
+}
+
+func TestAttemptOTPWithoutOTP(t *testing.T) {
+	orders := NewMemoryOrders()
+	order := paidOrder(t, orders)
+
+	if _, err := orders.AttemptOTP(context.Background(), order.OrderID, otp.Delivery, 3); !errors.Is(err, otp.ErrMissing) {
+		t.Errorf("AttemptOTP = %v, want ErrMissing", err)
+	}
+	if _, err := orders.ReplaceOTP(context.Background(), order.OrderID, Scope{}, lifecycle.InTransit, otp.Delivery, models.OTP{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReplaceOTP in another status = %v, want ErrNotFound", err)
+	}
+}
+
+func TestSetLocationKeepsNewestPosition(t *testing.T) {
+	orders := NewMemoryOrders()
+	order := paidOrder(t, orders)
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	point := func(lng float64) models.GeoPoint {
+		return models.GeoPoint{Type: "Point", Coordinates: []float64{lng, 21.2}}
+	}
+
+	tests := []struct {
+		name   string
+		at     time.Time
+		lng    float64
+		latest bool
+		want   float64
+	}{
+		{"first position", at, 81.6, true, 81.6},
+		{"newer position", at.Add(time.Minute), 81.7, true, 81.7},
+		{"older position", at.Add(30 * time.Second), 81.5, false, 81.7},
+		{"same timestamp", at.Add(time.Minute), 81.8, false, 81.7},
+	}
+	for _, tt := range tests {
+		latest, err := orders.SetLocation(context.Background(), order.OrderID, models.Location{Point: point(tt.lng), RecordedAt: tt.at})
+		if err != nil || latest != tt.latest {
+			t.Errorf("%s: SetLocation = %t, %v; want %t, nil", tt.name, latest, err, tt.latest)
+		}
+		stored, _ := orders.Get(context.Background(), order.OrderID, Scope{})
+		if last := stored.DeliveryInfo.LastLocation; last == nil || last.Point.Coordinates[0] != tt.want {
+			t.Errorf("%s: latest position is %+v, want longitude %v", tt.name, last, tt.want)
+		}
+	}
+}
@@ -0,0 +1,781 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// agentField is the order field holding the assigned delivery agent.
+const agentField = "deliveryInfo.deliveryAgentID"
+
+// unassigned matches orders no delivery agent has taken yet.
+var unassigned = bson.M{"$in": bson.A{0, nil}}
+
+// carrying matches the orders an agent has accepted and not yet delivered.
+var carrying = bson.M{"$in": bson.A{lifecycle.Assigned, lifecycle.InTransit}}
+
+// otpFields maps an OTP purpose to the order field it is stored in.
+var otpFields = map[string]string{
+	otp.Pickup:   "pickupOTP",
+	otp.Delivery: "deliveryOTP",
+}
+
+// MongoOrders stores orders in a MongoDB collection.
+type MongoOrders struct {
+	collection *mongo.Collection
+}
+
+func NewMongoOrders(collection *mongo.Collection) *MongoOrders {
+	return &MongoOrders{collection: collection}
+}
+
+// filter builds the query for an order ID within a scope.
+func (r *MongoOrders) filter(id primitive.ObjectID, scope Scope) bson.M {
+	filter := bson.M{"_id": id}
+	if scope.UserID != nil {
+		filter["userID"] = *scope.UserID
+	}
+	if scope.StoreID != nil {
+		filter["storeID"] = *scope.StoreID
+	}
+	if scope.AgentID != nil {
+		filter[agentField] = *scope.AgentID
+	}
+	if scope.Unassigned {
+		filter[agentField] = unassigned
+	}
+	return filter
+}
+
+func (r *MongoOrders) findOne(ctx context.Context, filter bson.M) (models.Order, error) {
+	var order models.Order
+	err := r.collection.FindOne(ctx, filter).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return order, ErrNotFound
+	}
+	return order, err
+}
+
+func (r *MongoOrders) find(ctx context.Context, filter bson.M) ([]models.Order, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	orders := []models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *MongoOrders) Get(ctx context.Context, id primitive.ObjectID, scope Scope) (models.Order, error) {
+	return r.findOne(ctx, r.filter(id, scope))
+}
+
+func (r *MongoOrders) GetByGatewayOrder(ctx context.Context, gatewayOrderID string) (models.Order, error) {
+	return r.findOne(ctx, bson.M{"payment.gatewayOrderID": gatewayOrderID})
+}
+
+func (r *MongoOrders) ListByUser(ctx context.Context, userID models.UserID) ([]models.Order, error) {
+	return r.find(ctx, bson.M{"userID": userID})
+}
+
+func (r *MongoOrders) ListByStore(ctx context.Context, storeID models.StoreID) ([]models.Order, error) {
+	return r.find(ctx, bson.M{"storeID": storeID})
+}
+
+func (r *MongoOrders) ListByAgent(ctx context.Context, agentID models.AgentID) ([]models.Order, error) {
+	return r.find(ctx, bson.M{agentField: agentID})
+}
+
+func (r *MongoOrders) ListOpen(ctx context.Context) ([]models.Order, error) {
+	filter := bson.M{"status": lifecycle.Ready, agentField: unassigned}
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	orders := []models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *MongoOrders) CountCarrying(ctx context.Context, agentIDs ...models.AgentID) (map[models.AgentID]int, error) {
+	ids := make(bson.A, 0, len(agentIDs))
+	for _, id := range agentIDs {
+		ids = append(ids, id)
+	}
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{agentField: bson.M{"$in": ids}, "status": carrying}}},
+		{{Key: "$group", Value: bson.M{"_id": "$" + agentField, "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		AgentID models.AgentID `bson:"_id"`
+		Count   int            `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[models.AgentID]int, len(rows))
+	for _, row := range rows {
+		counts[row.AgentID] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *MongoOrders) Insert(ctx context.Context, order models.Order) error {
+	_, err := r.collection.InsertOne(ctx, order)
+	return err
+}
+
+// Transition moves the order in a transaction together with the writes of
+// the lifecycle recorders, and informs the listeners once it has committed.
+func (r *MongoOrders) Transition(ctx context.Context, id primitive.ObjectID, scope Scope, t lifecycle.Transition) (models.Order, error) {
+	var updated models.Order
+	var change models.StatusChange
+	tx := NewMongoTransactor(r.collection.Database().Client())
+	err := tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		updated, change, err = lifecycle.Move(ctx, r.collection, r.filter(id, scope), t)
+		return err
+	})
+	if err != nil {
+		return updated, err
+	}
+
+	lifecycle.Notify(updated, change)
+	return updated, nil
+}
+
+func (r *MongoOrders) Adjust(ctx context.Context, order models.Order, adjustment models.Adjustment) error {
+	// Only apply the change if nobody else touched the order since it was read
+	filter := bson.M{"_id": order.OrderID, "status": order.Status, "updatedAt": order.UpdatedAt}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"items":          bson.M{"$literal": order.Items},
+		"totalAmount":    order.TotalAmount,
+		"payment.amount": order.Payment.Amount,
+		"updatedAt":      adjustment.At,
+		"adjustments":    appendTo("$adjustments", adjustment),
+	}}}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return lifecycle.ErrConflict
+	}
+	return nil
+}
+
+func (r *MongoOrders) SetPayment(ctx context.Context, id primitive.ObjectID, info models.PaymentInfo) error {
+	filter := bson.M{"_id": id, "status": lifecycle.PendingPayment, "payment.gatewayOrderID": ""}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"payment": info, "updatedAt": time.Now().UTC()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoOrders) MarkPaymentFailed(ctx context.Context, gatewayOrderID, paymentID string) (bool, error) {
+	filter := bson.M{"payment.gatewayOrderID": gatewayOrderID, "status": lifecycle.PendingPayment}
+	update := bson.M{"$set": bson.M{
+		"payment.status":    payment.StatusFailed,
+		"payment.paymentID": paymentID,
+		"updatedAt":         time.Now().UTC(),
+	}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r *MongoOrders) AddRefund(ctx context.Context, id primitive.ObjectID, refund models.Refund) error {
+	// $push fails on orders stored with refunds: null, so append in a pipeline
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"refunds":   appendTo("$refunds", refund),
+		"updatedAt": refund.CreatedAt,
+	}}}}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// appendTo is an aggregation expression that appends value to the array at
+// field, treating a missing or null field as empty.
+func appendTo(field string, value interface{}) bson.M {
+	return bson.M{"$concatArrays": bson.A{
+		bson.M{"$ifNull": bson.A{field, bson.A{}}},
+		bson.M{"$literal": bson.A{value}},
+	}}
+}
+
+func (r *MongoOrders) SetRefundStatus(ctx context.Context, refundID, status string) error {
+	now := time.Now().UTC()
+	update := bson.M{"$set": bson.M{
+		"refunds.$.status":    status,
+		"refunds.$.updatedAt": now,
+		"updatedAt":           now,
+	}}
+	_, err := r.collection.UpdateOne(ctx, bson.M{"refunds.refundID": refundID}, update)
+	return err
+}
+
+func (r *MongoOrders) ListFailedRefunds(ctx context.Context) ([]models.Order, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"refunds.status": payment.RefundFailed}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	orders := []models.Order{}
+	if err := cursor.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (r *MongoOrders) UpdateRefund(ctx context.Context, id, refundID primitive.ObjectID, from, gatewayRefundID, status string) error {
+	now := time.Now().UTC()
+	filter := bson.M{"_id": id, "refunds": bson.M{"$elemMatch": bson.M{"id": refundID, "status": from}}}
+	update := bson.M{"$set": bson.M{
+		"refunds.$.refundID":  gatewayRefundID,
+		"refunds.$.status":    status,
+		"refunds.$.updatedAt": now,
+		"updatedAt":           now,
+	}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoOrders) AttemptOTP(ctx context.Context, id primitive.ObjectID, purpose string, maxAttempts int) (models.OTP, error) {
+	field := otpFields[purpose]
+	filter := bson.M{"_id": id, field + ".attempts": bson.M{"$lt": maxAttempts}}
+	update := bson.M{"$inc": bson.M{field + ".attempts": 1}}
+	opts := options.FindOneAndUpdate().SetProjection(bson.M{field: 1})
+
+	var order models.Order
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id, field: bson.M{"$type": "object"}})
+		if err != nil {
+			return models.OTP{}, err
+		}
+		if count > 0 {
+			return models.OTP{}, otp.ErrLocked
+		}
+		return models.OTP{}, otp.ErrMissing
+	}
+	if err != nil {
+		return models.OTP{}, err
+	}
+
+	stored := order.PickupOTP
+	if purpose == otp.Delivery {
+		stored = order.DeliveryOTP
+	}
+	if stored == nil {
+		return models.OTP{}, otp.ErrMissing
+	}
+	return *stored, nil
+}
+
+func (r *MongoOrders) ReplaceOTP(ctx context.Context, id primitive.ObjectID, scope Scope, status, purpose string, record models.OTP) (models.Order, error) {
+	filter := r.filter(id, scope)
+	filter["status"] = status
+	update := bson.M{"$set": bson.M{otpFields[purpose]: record, "updatedAt": time.Now().UTC()}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var order models.Order
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&order)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return order, ErrNotFound
+	}
+	return order, err
+}
+
+func (r *MongoOrders) SetLocation(ctx context.Context, id primitive.ObjectID, location models.Location) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx, olderLocation(id, location), bson.M{"$set": bson.M{"deliveryInfo.lastLocation": location}})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// olderLocation matches the order when it has no position yet or its latest
+// position was recorded before location, so the latest position only moves
+// forward in time.
+func olderLocation(id primitive.ObjectID, location models.Location) bson.M {
+	return bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"deliveryInfo.lastLocation": nil},
+			bson.M{"deliveryInfo.lastLocation.recordedAt": bson.M{"$lt": location.RecordedAt}},
+		},
+	}
+}
+
+// cartTotals is an update pipeline that recomputes every line total and the
+// cart total from the items currently stored in the cart, and touches the
+// cart timestamps.
+var cartTotals = mongo.Pipeline{
+	{{Key: "$set", Value: bson.M{"items": bson.M{"$map": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$items", bson.A{}}},
+		"as":    "item",
+		"in": bson.M{"$mergeObjects": bson.A{"$$item", bson.M{
+			"lineTotal": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{"$$item.price", "$$item.quantity"}}, 2}},
+		}}},
+	}}}}},
+	{{Key: "$set", Value: bson.M{
+		"totalAmount": bson.M{"$round": bson.A{bson.M{"$sum": "$items.lineTotal"}, 2}},
+		"createdAt":   bson.M{"$ifNull": bson.A{"$createdAt", "$$NOW"}},
+		"updatedAt":   "$$NOW",
+	}}},
+}
+
+// MongoCarts stores carts in a MongoDB collection, one document per user.
+type MongoCarts struct {
+	collection *mongo.Collection
+}
+
+func NewMongoCarts(collection *mongo.Collection) *MongoCarts {
+	return &MongoCarts{collection: collection}
+}
+
+func (r *MongoCarts) Get(ctx context.Context, userID models.UserID) (models.Order, error) {
+	var cart models.Order
+	err := r.collection.FindOne(ctx, bson.M{"userID": userID}).Decode(&cart)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return cart, ErrNotFound
+	}
+	return cart, err
+}
+
+func (r *MongoCarts) Upsert(ctx context.Context, userID models.UserID, cart models.Order) (models.Order, error) {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"userID": userID}, cartReplacement(cart), options.Update().SetUpsert(true))
+	if err != nil {
+		return models.Order{}, err
+	}
+	return r.totals(ctx, userID)
+}
+
+// cartReplacement is the update that replaces the store and items of a cart.
+// Items are stored as an empty array rather than null so AddItem can $push.
+func cartReplacement(cart models.Order) bson.M {
+	items := cart.Items
+	if items == nil {
+		items = []models.OrderItem{}
+	}
+	return bson.M{"$set": bson.M{"storeID": cart.StoreID, "items": items}}
+}
+
+func (r *MongoCarts) AddItem(ctx context.Context, userID models.UserID, storeID models.StoreID, line models.OrderItem, replace bool) (models.Order, error) {
+	if err := r.addItem(ctx, userID, storeID, line, replace); err != nil {
+		return models.Order{}, err
+	}
+	return r.totals(ctx, userID)
+}
+
+func (r *MongoCarts) addItem(ctx context.Context, userID models.UserID, storeID models.StoreID, line models.OrderItem, replace bool) error {
+	if replace {
+		update := bson.M{"$set": bson.M{"storeID": storeID, "items": []models.OrderItem{line}}}
+		_, err := r.collection.UpdateOne(ctx, bson.M{"userID": userID}, update, options.Update().SetUpsert(true))
+		return err
+	}
+
+	// Bump the quantity if the item is already in the cart
+	filter := bson.M{"userID": userID, "storeID": storeID, "items._id": line.ItemID}
+	update := bson.M{"$inc": bson.M{"items.$.quantity": line.Quantity}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil || result.MatchedCount > 0 {
+		return err
+	}
+
+	// Otherwise append it to a cart for the same store, or to an empty cart
+	filter = bson.M{"userID": userID, "$or": bson.A{
+		bson.M{"storeID": storeID},
+		bson.M{"items.0": bson.M{"$exists": false}},
+	}}
+	update = bson.M{
+		"$set":  bson.M{"storeID": storeID},
+		"$push": bson.M{"items": line},
+	}
+	result, err = r.collection.UpdateOne(ctx, filter, update)
+	if err != nil || result.MatchedCount > 0 {
+		return err
+	}
+
+	// No usable cart, so create one unless the user has a cart for another store
+	update = bson.M{"$setOnInsert": bson.M{"storeID": storeID, "items": []models.OrderItem{line}}}
+	result, err = r.collection.UpdateOne(ctx, bson.M{"userID": userID}, update, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if result.UpsertedCount == 0 {
+		return ErrOtherStore
+	}
+	return nil
+}
+
+func (r *MongoCarts) SetQuantity(ctx context.Context, userID models.UserID, itemID primitive.ObjectID, quantity int) (models.Order, error) {
+	filter := bson.M{"userID": userID, "items._id": itemID}
+	update := bson.M{"$set": bson.M{"items.$.quantity": quantity}}
+	return r.updateItem(ctx, userID, filter, update)
+}
+
+func (r *MongoCarts) RemoveItem(ctx context.Context, userID models.UserID, itemID primitive.ObjectID) (models.Order, error) {
+	filter := bson.M{"userID": userID, "items._id": itemID}
+	update := bson.M{"$pull": bson.M{"items": bson.M{"_id": itemID}}}
+	return r.updateItem(ctx, userID, filter, update)
+}
+
+func (r *MongoCarts) updateItem(ctx context.Context, userID models.UserID, filter, update bson.M) (models.Order, error) {
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return models.Order{}, err
+	}
+	if result.MatchedCount == 0 {
+		return models.Order{}, ErrNotFound
+	}
+	return r.totals(ctx, userID)
+}
+
+// totals recomputes the totals of the user's cart and returns it.
+func (r *MongoCarts) totals(ctx context.Context, userID models.UserID) (models.Order, error) {
+	var cart models.Order
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"userID": userID}, cartTotals, opts).Decode(&cart)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return cart, ErrNotFound
+	}
+	return cart, err
+}
+
+func (r *MongoCarts) Clear(ctx context.Context, userID models.UserID) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"userID": userID})
+	return err
+}
+
+func (r *MongoCarts) Delete(ctx context.Context, userID models.UserID, cartID primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": cartID, "userID": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoCarts) ListAbandoned(ctx context.Context, before time.Time) ([]models.Order, error) {
+	// Checked out carts are deleted, so anything left untouched is abandoned
+	filter := bson.M{
+		"updatedAt": bson.M{"$lt": before},
+		"items.0":   bson.M{"$exists": true},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	carts := []models.Order{}
+	if err := cursor.All(ctx, &carts); err != nil {
+		return nil, err
+	}
+	return carts, nil
+}
+
+// MongoStores reads the merchant to store mapping from a MongoDB collection.
+type MongoStores struct {
+	collection *mongo.Collection
+}
+
+func NewMongoStores(collection *mongo.Collection) *MongoStores {
+	return &MongoStores{collection: collection}
+}
+
+func (r *MongoStores) ForMerchant(ctx context.Context, merchantID models.MerchantID) (models.Store, error) {
+	var store models.Store
+	err := r.collection.FindOne(ctx, bson.M{"merchantID": merchantID}).Decode(&store)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return store, ErrNoStore
+	}
+	return store, err
+}
+
+// MongoAgents stores delivery agent availability in a MongoDB collection,
+// keyed by the agent's account ID.
+type MongoAgents struct {
+	collection *mongo.Collection
+}
+
+func NewMongoAgents(collection *mongo.Collection) *MongoAgents {
+	return &MongoAgents{collection: collection}
+}
+
+func (r *MongoAgents) Get(ctx context.Context, agentID models.AgentID) (models.Agent, error) {
+	var agent models.Agent
+	err := r.collection.FindOne(ctx, bson.M{"_id": agentID}).Decode(&agent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return agent, ErrNotFound
+	}
+	return agent, err
+}
+
+func (r *MongoAgents) GoOnline(ctx context.Context, agentID models.AgentID, capacity, defaultCapacity int, at time.Time) (models.Agent, error) {
+	set := bson.M{"online": true, "lastSeenAt": at}
+	if capacity > 0 {
+		set["capacity"] = capacity
+	}
+
+	// A shift only starts when an offline agent comes online
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"shiftStartedAt": bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$online", true}}, "$shiftStartedAt", at,
+		}}}}},
+		{{Key: "$set", Value: set}},
+		// New agents start with the default capacity
+		{{Key: "$set", Value: bson.M{
+			"capacity": bson.M{"$ifNull": bson.A{"$capacity", defaultCapacity}},
+		}}},
+	}
+	return r.update(ctx, agentID, update, true)
+}
+
+func (r *MongoAgents) GoOffline(ctx context.Context, agentID models.AgentID, at time.Time) (models.Agent, error) {
+	update := bson.M{
+		"$set":   bson.M{"online": false, "lastSeenAt": at},
+		"$unset": bson.M{"shiftStartedAt": ""},
+	}
+	return r.update(ctx, agentID, update, false)
+}
+
+func (r *MongoAgents) update(ctx context.Context, agentID models.AgentID, update interface{}, upsert bool) (models.Agent, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(upsert)
+
+	var agent models.Agent
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": agentID}, update, opts).Decode(&agent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return agent, ErrNotFound
+	}
+	return agent, err
+}
+
+func (r *MongoAgents) ListOnline(ctx context.Context) ([]models.Agent, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"online": true})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	agents := []models.Agent{}
+	if err := cursor.All(ctx, &agents); err != nil {
+		return nil, err
+	}
+	return agents, nil
+}
+
+func (r *MongoAgents) Hold(ctx context.Context, agentID models.AgentID, now, until time.Time) error {
+	filter := bson.M{"_id": agentID, "online": true, "$or": bson.A{
+		bson.M{"heldUntil": nil},
+		bson.M{"heldUntil": bson.M{"$lt": now}},
+	}}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"heldUntil": until}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *MongoAgents) Unhold(ctx context.Context, agentID models.AgentID) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": agentID}, bson.M{"$unset": bson.M{"heldUntil": ""}})
+	return err
+}
+
+// MongoTrail stores trail points in a MongoDB collection.
+type MongoTrail struct {
+	collection *mongo.Collection
+}
+
+func NewMongoTrail(collection *mongo.Collection) *MongoTrail {
+	return &MongoTrail{collection: collection}
+}
+
+func (r *MongoTrail) Add(ctx context.Context, point models.TrailPoint) error {
+	_, err := r.collection.InsertOne(ctx, point)
+	return err
+}
+
+func (r *MongoTrail) Recent(ctx context.Context, orderID primitive.ObjectID, limit int64) ([]models.TrailPoint, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "recordedAt", Value: -1}}).SetLimit(limit)
+	cursor, err := r.collection.Find(ctx, bson.M{"orderID": orderID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	points := []models.TrailPoint{}
+	if err := cursor.All(ctx, &points); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(points)-1; i < j; i, j = i+1, j-1 {
+		points[i], points[j] = points[j], points[i]
+	}
+	return points, nil
+}
+
+// MongoMerchantEvents stores board events in a MongoDB collection. The last
+// sequence number handed out for each store is kept in a counters
+// collection.
+type MongoMerchantEvents struct {
+	collection *mongo.Collection
+	counters   *mongo.Collection
+}
+
+func NewMongoMerchantEvents(collection, counters *mongo.Collection) *MongoMerchantEvents {
+	return &MongoMerchantEvents{collection: collection, counters: counters}
+}
+
+func (r *MongoMerchantEvents) Append(ctx context.Context, event models.MerchantEvent) (models.MerchantEvent, error) {
+	update := bson.M{"$inc": bson.M{"seq": int64(1)}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+	err := r.counters.FindOneAndUpdate(ctx, bson.M{"_id": event.StoreID}, update, opts).Decode(&counter)
+	if err != nil {
+		return event, err
+	}
+	event.Seq = counter.Seq
+
+	_, err = r.collection.InsertOne(ctx, event)
+	return event, err
+}
+
+func (r *MongoMerchantEvents) Latest(ctx context.Context, storeID models.StoreID) (int64, error) {
+	var event models.MerchantEvent
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+	err := r.collection.FindOne(ctx, bson.M{"storeID": storeID}, opts).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	return event.Seq, err
+}
+
+func (r *MongoMerchantEvents) Since(ctx context.Context, storeID models.StoreID, seq int64, limit int64) ([]models.MerchantEvent, error) {
+	filter := bson.M{"storeID": storeID, "seq": bson.M{"$gt": seq}}
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(limit)
+
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []models.MerchantEvent{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// MongoWebhookEvents records handled webhook events in a MongoDB collection,
+// keyed by the event ID so a second claim fails on the duplicate key.
+type MongoWebhookEvents struct {
+	collection *mongo.Collection
+}
+
+func NewMongoWebhookEvents(collection *mongo.Collection) *MongoWebhookEvents {
+	return &MongoWebhookEvents{collection: collection}
+}
+
+func (r *MongoWebhookEvents) Claim(ctx context.Context, id, event string) (bool, error) {
+	_, err := r.collection.InsertOne(ctx, bson.M{"_id": id, "event": event, "receivedAt": time.Now().UTC()})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *MongoWebhookEvents) Release(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// illegalOperation is the server error code returned when transactions are
+// used against a standalone MongoDB.
+const illegalOperation = 20
+
+// MongoTransactor runs functions inside MongoDB transactions.
+type MongoTransactor struct {
+	client *mongo.Client
+}
+
+func NewMongoTransactor(client *mongo.Client) *MongoTransactor {
+	return &MongoTransactor{client: client}
+}
+
+// WithTransaction runs fn inside a MongoDB transaction. Deployments without
+// transaction support (a standalone server) run fn directly instead.
+func (t *MongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return fn(ctx)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == illegalOperation {
+		return fn(ctx)
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCartReplacementStoresItemsAsArray(t *testing.T) {
+	raw, err := bson.Marshal(cartReplacement(models.Order{StoreID: models.NewStoreID()}))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	// MongoDB rejects $push onto a null field
+	items, err := bson.Raw(raw).LookupErr("$set", "items")
+	if err != nil {
+		t.Fatalf("items are missing: %v", err)
+	}
+	if items.Type != bson.TypeArray {
+		t.Errorf("items are stored as %s, want an array", items.Type)
+	}
+}
+
+func TestOlderLocationOnlyMatchesEarlierPositions(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	filter := olderLocation(primitive.NewObjectID(), models.Location{RecordedAt: at})
+
+	or, ok := filter["$or"].(bson.A)
+	if !ok || len(or) != 2 {
+		t.Fatalf("filter = %v, want an $or of two conditions", filter)
+	}
+	if missing := or[0].(bson.M); missing["deliveryInfo.lastLocation"] != nil {
+		t.Errorf("first condition = %v, want a missing position", missing)
+	}
+	older, _ := or[1].(bson.M)["deliveryInfo.lastLocation.recordedAt"].(bson.M)
+	if got, ok := older["$lt"].(time.Time); !ok || !got.Equal(at) {
+		t.Errorf("second condition = %v, want recordedAt $lt %s", older, at)
+	}
+}
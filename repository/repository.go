@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrNoStore    = errors.New("no store is registered for the merchant")
+	ErrOtherStore = errors.New("cart contains items from another store")
+)
+
+// Scope restricts an order lookup to the orders a caller may act on. The zero
+// Scope matches any order.
+type Scope struct {
+	UserID     *models.UserID
+	StoreID    *models.StoreID
+	AgentID    *models.AgentID
+	Unassigned bool
+}
+
+// User scopes lookups to the orders a customer placed.
+func User(userID models.UserID) Scope {
+	return Scope{UserID: &userID}
+}
+
+// Store scopes lookups to the orders of a merchant's store.
+func Store(storeID models.StoreID) Scope {
+	return Scope{StoreID: &storeID}
+}
+
+// Agent scopes lookups to the orders assigned to a delivery agent.
+func Agent(agentID models.AgentID) Scope {
+	return Scope{AgentID: &agentID}
+}
+
+// Unassigned scopes lookups to the orders no delivery agent has taken yet.
+func Unassigned() Scope {
+	return Scope{Unassigned: true}
+}
+
+// OrderRepository stores orders. Lookups that match nothing return
+// ErrNotFound; Transition returns the lifecycle errors.
+type OrderRepository interface {
+	Get(ctx context.Context, id primitive.ObjectID, scope Scope) (models.Order, error)
+	GetByGatewayOrder(ctx context.Context, gatewayOrderID string) (models.Order, error)
+	ListByUser(ctx context.Context, userID models.UserID) ([]models.Order, error)
+	ListByStore(ctx context.Context, storeID models.StoreID) ([]models.Order, error)
+	ListByAgent(ctx context.Context, agentID models.AgentID) ([]models.Order, error)
+
+	// ListOpen lists the orders that are ready for pickup and have no
+	// delivery agent, oldest first.
+	ListOpen(ctx context.Context) ([]models.Order, error)
+
+	// CountCarrying counts, for each of the agents, the orders they accepted
+	// and have not delivered yet. Agents carrying nothing are left out.
+	CountCarrying(ctx context.Context, agentIDs ...models.AgentID) (map[models.AgentID]int, error)
+
+	Insert(ctx context.Context, order models.Order) error
+
+	// Transition moves the order through the lifecycle, see lifecycle.Move.
+	// The lifecycle recorders write along with the move and the listeners
+	// are informed once it is stored.
+	Transition(ctx context.Context, id primitive.ObjectID, scope Scope, t lifecycle.Transition) (models.Order, error)
+
+	// Adjust stores the items, total and payment amount of an order changed
+	// by a merchant along with the adjustment. It returns
+	// lifecycle.ErrConflict if the order changed since it was read.
+	Adjust(ctx context.Context, order models.Order, adjustment models.Adjustment) error
+
+	// SetPayment stores the gateway order of an order that is awaiting
+	// payment and has none yet. It returns ErrNotFound otherwise.
+	SetPayment(ctx context.Context, id primitive.ObjectID, info models.PaymentInfo) error
+
+	// MarkPaymentFailed records a failed payment on the order awaiting the
+	// gateway order, and reports whether there was one.
+	MarkPaymentFailed(ctx context.Context, gatewayOrderID, paymentID string) (bool, error)
+	AddRefund(ctx context.Context, id primitive.ObjectID, refund models.Refund) error
+	SetRefundStatus(ctx context.Context, refundID, status string) error
+
+	// ListFailedRefunds lists the orders holding a refund that failed,
+	// oldest first.
+	ListFailedRefunds(ctx context.Context) ([]models.Order, error)
+
+	// UpdateRefund stores the gateway refund ID and status of the order's
+	// refund with the given ID if its status is still from, and returns
+	// ErrNotFound otherwise.
+	UpdateRefund(ctx context.Context, id, refundID primitive.ObjectID, from, gatewayRefundID, status string) error
+
+	// AttemptOTP counts an attempt at the OTP for purpose and returns the
+	// OTP as it was before the attempt. Counting happens before the code is
+	// compared, so parallel guesses cannot exceed maxAttempts. It returns
+	// otp.ErrLocked once maxAttempts attempts were made and otp.ErrMissing
+	// if the order has no such OTP.
+	AttemptOTP(ctx context.Context, id primitive.ObjectID, purpose string, maxAttempts int) (models.OTP, error)
+
+	// ReplaceOTP stores a new OTP for purpose on an order within scope that
+	// is in the given status, discarding the old one and its attempts.
+	ReplaceOTP(ctx context.Context, id primitive.ObjectID, scope Scope, status, purpose string, record models.OTP) (models.Order, error)
+
+	// SetLocation stores location as the latest position of the order's
+	// delivery agent, unless a newer one is already stored, and reports
+	// whether it did.
+	SetLocation(ctx context.Context, id primitive.ObjectID, location models.Location) (bool, error)
+}
+
+// CartRepository stores each user's cart. Methods that change a cart return
+// it with its line totals and total recomputed.
+type CartRepository interface {
+	Get(ctx context.Context, userID models.UserID) (models.Order, error)
+
+	// Upsert replaces the store and items of the user's cart, creating it if
+	// needed. The items must already carry catalog prices.
+	Upsert(ctx context.Context, userID models.UserID, cart models.Order) (models.Order, error)
+
+	// AddItem adds line to the cart, or bumps its quantity. A cart only holds
+	// items from one store; ErrOtherStore is returned unless replace is set,
+	// which discards the current contents instead.
+	AddItem(ctx context.Context, userID models.UserID, storeID models.StoreID, line models.OrderItem, replace bool) (models.Order, error)
+	SetQuantity(ctx context.Context, userID models.UserID, itemID primitive.ObjectID, quantity int) (models.Order, error)
+	RemoveItem(ctx context.Context, userID models.UserID, itemID primitive.ObjectID) (models.Order, error)
+	Clear(ctx context.Context, userID models.UserID) error
+
+	// Delete removes a checked out cart. It returns ErrNotFound if the cart
+	// is already gone, so a repeated checkout does not place a second order.
+	Delete(ctx context.Context, userID models.UserID, cartID primitive.ObjectID) error
+
+	// ListAbandoned lists non-empty carts last changed before the given
+	// time, oldest first.
+	ListAbandoned(ctx context.Context, before time.Time) ([]models.Order, error)
+}
+
+// StoreRepository maps merchant accounts to the store they run.
+type StoreRepository interface {
+	// ForMerchant returns the merchant's store, or ErrNoStore.
+	ForMerchant(ctx context.Context, merchantID models.MerchantID) (models.Store, error)
+}
+
+// AgentRepository stores the availability of delivery agents. Active is
+// not stored; see OrderRepository.CountCarrying. Get and GoOffline return
+// ErrNotFound for agents that never went online.
+type AgentRepository interface {
+	Get(ctx context.Context, agentID models.AgentID) (models.Agent, error)
+
+	// GoOnline marks the agent online at the given time, starting a shift
+	// unless one is running. A capacity of zero keeps the stored capacity,
+	// or defaultCapacity for new agents.
+	GoOnline(ctx context.Context, agentID models.AgentID, capacity, defaultCapacity int, at time.Time) (models.Agent, error)
+	GoOffline(ctx context.Context, agentID models.AgentID, at time.Time) (models.Agent, error)
+	ListOnline(ctx context.Context) ([]models.Agent, error)
+
+	// Hold marks an online agent as busy accepting an order until the given
+	// time. It returns ErrNotFound if the agent is offline or an earlier hold
+	// has not ended or expired by now.
+	Hold(ctx context.Context, agentID models.AgentID, now, until time.Time) error
+	Unhold(ctx context.Context, agentID models.AgentID) error
+}
+
+// TrailRepository stores every position delivery agents report for an order.
+type TrailRepository interface {
+	Add(ctx context.Context, point models.TrailPoint) error
+
+	// Recent returns up to limit of the order's newest points, oldest first.
+	Recent(ctx context.Context, orderID primitive.ObjectID, limit int64) ([]models.TrailPoint, error)
+}
+
+// MerchantEventRepository stores the events on each store's order board.
+type MerchantEventRepository interface {
+	// Append stores the event under the next sequence number of its store.
+	// Concurrent appends never get the same number.
+	Append(ctx context.Context, event models.MerchantEvent) (models.MerchantEvent, error)
+
+	// Latest returns the sequence number of the store's newest event, or zero.
+	Latest(ctx context.Context, storeID models.StoreID) (int64, error)
+
+	// Since returns up to limit of the store's events after seq, oldest first.
+	Since(ctx context.Context, storeID models.StoreID, seq int64, limit int64) ([]models.MerchantEvent, error)
+}
+
+// WebhookEventRepository records the payment webhook events that have been
+// handled so that retried deliveries are not applied twice.
+type WebhookEventRepository interface {
+	// Claim records the event and reports whether this call is the first to
+	// see it. Only the first caller should process the event.
+	Claim(ctx context.Context, id, event string) (bool, error)
+
+	// Release forgets an event whose processing failed so a retry can claim it.
+	Release(ctx context.Context, id string) error
+}
+
+// Transactor runs fn so that the repository calls it makes with the given
+// context succeed or fail together, where the backend supports it.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
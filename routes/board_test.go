@@ -0,0 +1,116 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/board"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/gorilla/websocket"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// boardEvent records on the board that an order of the merchant's store
+// moved to status, as the lifecycle recorder and listener would.
+func (s *testServer) boardEvent(status string) models.Order {
+	order := models.Order{
+		OrderID:     primitive.NewObjectID(),
+		StoreID:     s.item.StoreID,
+		UserID:      1,
+		Status:      status,
+		TotalAmount: 5,
+		Payment:     models.PaymentInfo{GatewayOrderID: "order_1", PaymentID: "pay_1", Amount: 500, Status: payment.StatusPaid},
+		PickupOTP:   &models.OTP{Hash: "pickup-hash", ExpiresAt: time.Now().Add(time.Minute)},
+	}
+	change := models.StatusChange{From: lifecycle.PendingPayment, To: status, ActorType: string(lifecycle.System), At: time.Now().UTC()}
+	if err := s.board.Record(context.Background(), order, change); err != nil {
+		s.t.Fatalf("record board event: %v", err)
+	}
+	s.board.OrderTransitioned(order, change)
+	return order
+}
+
+// openBoard connects to the merchant board as merchant 3.
+func (s *testServer) openBoard(server *httptest.Server, query string) *websocket.Conn {
+	header := http.Header{}
+	header.Set("Cookie", s.login(3, "merchant").String())
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/v1/merchant/board" + query
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		s.t.Fatalf("dial board: %v (%v)", err, resp)
+	}
+	return conn
+}
+
+// readEvent reads the next board event and its raw JSON.
+func readEvent(t *testing.T, conn *websocket.Conn) (models.MerchantEvent, string) {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, raw, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read board event: %v", err)
+	}
+	var event models.MerchantEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		t.Fatalf("decode board event %s: %v", raw, err)
+	}
+	return event, string(raw)
+}
+
+func TestBoardResumesAfterMissedEvents(t *testing.T) {
+	s := newTestServer(t)
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	first := s.boardEvent(lifecycle.Paid)
+	conn := s.openBoard(server, "?since=0")
+	event, raw := readEvent(t, conn)
+	if event.Seq != 1 || event.Order.OrderID != first.OrderID || event.Type != board.OrderPaid {
+		t.Fatalf("first event = %+v, want order.paid of %s with seq 1", event, first.OrderID.Hex())
+	}
+	for _, secret := range []string{"pickup-hash", "pay_1", "order_1", "payment"} {
+		if strings.Contains(raw, secret) {
+			t.Errorf("board event %s exposes %q", raw, secret)
+		}
+	}
+	conn.Close()
+
+	// Events while the merchant is away are sent once they come back
+	missed := []models.Order{s.boardEvent(lifecycle.Paid), s.boardEvent(lifecycle.Cancelled)}
+	conn = s.openBoard(server, "?since="+strconv.FormatInt(event.Seq, 10))
+	defer conn.Close()
+	for i, order := range missed {
+		event, _ := readEvent(t, conn)
+		if event.Seq != int64(i+2) || event.Order.OrderID != order.OrderID {
+			t.Errorf("resumed event %d = seq %d of %s, want seq %d of %s", i, event.Seq, event.Order.OrderID.Hex(), i+2, order.OrderID.Hex())
+		}
+	}
+
+	// and new ones keep arriving
+	live := s.boardEvent(lifecycle.Paid)
+	if event, _ := readEvent(t, conn); event.Seq != 4 || event.Order.OrderID != live.OrderID {
+		t.Errorf("live event = seq %d of %s, want seq 4 of %s", event.Seq, event.Order.OrderID.Hex(), live.OrderID.Hex())
+	}
+}
+
+func TestBoardWithoutSinceOnlySendsNewEvents(t *testing.T) {
+	s := newTestServer(t)
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	s.boardEvent(lifecycle.Paid)
+	conn := s.openBoard(server, "")
+	defer conn.Close()
+
+	live := s.boardEvent(lifecycle.Cancelled)
+	if event, _ := readEvent(t, conn); event.Seq != 2 || event.Order.OrderID != live.OrderID {
+		t.Errorf("first event = seq %d of %s, want seq 2 of %s", event.Seq, event.Order.OrderID.Hex(), live.OrderID.Hex())
+	}
+}
@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// awaitingPickup stores an order assigned to delivery agent 5 and gives it a
+// pickup OTP, returning the order and the code.
+func (s *testServer) awaitingPickup(ttl time.Duration) (models.Order, string) {
+	order := models.Order{
+		OrderID:      primitive.NewObjectID(),
+		StoreID:      s.item.StoreID,
+		UserID:       1,
+		Status:       lifecycle.Assigned,
+		DeliveryInfo: models.DeliveryInfo{DeliveryAgentID: 5},
+		CreatedAt:    time.Now().UTC(),
+		UpdatedAt:    time.Now().UTC(),
+	}
+	if err := s.orders.Insert(context.Background(), order); err != nil {
+		s.t.Fatalf("insert order: %v", err)
+	}
+	return order, s.issuePickupOTP(order, ttl)
+}
+
+// issuePickupOTP replaces the pickup OTP of the order with one issued under
+// the test server's secret and returns its code.
+func (s *testServer) issuePickupOTP(order models.Order, ttl time.Duration) string {
+	code, record, err := otp.NewIssuer("test-secret", ttl, 3).Issue(otp.Pickup)
+	if err != nil {
+		s.t.Fatalf("issue OTP: %v", err)
+	}
+	if _, err := s.orders.ReplaceOTP(context.Background(), order.OrderID, repository.Scope{}, lifecycle.Assigned, otp.Pickup, record); err != nil {
+		s.t.Fatalf("store OTP: %v", err)
+	}
+	return code
+}
+
+func wrongCode(code string) string {
+	if code == "000000" {
+		return "111111"
+	}
+	return "000000"
+}
+
+func TestPickupOTPLocksAfterMaxAttempts(t *testing.T) {
+	s := newTestServer(t)
+	merchant := s.login(3, "merchant")
+	order, code := s.awaitingPickup(time.Minute)
+	verify := "/api/v1/merchant/verify/" + order.OrderID.Hex()
+
+	for i := 0; i < 3; i++ {
+		if rec := s.do(merchant, http.MethodPost, verify, gin.H{"otp": wrongCode(code)}); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong code %d got %d, want %d", i+1, rec.Code, http.StatusUnauthorized)
+		}
+	}
+	if rec := s.do(merchant, http.MethodPost, verify, gin.H{"otp": code}); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("right code after lockout got %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if status := s.get(order).Status; status != lifecycle.Assigned {
+		t.Fatalf("order is %s, want %s", status, lifecycle.Assigned)
+	}
+
+	// The agent asks for a new code, which starts without failed attempts
+	agent := s.login(5, "delivery_agent")
+	if rec := s.do(agent, http.MethodPost, "/api/v1/deliveryagent/otp/"+order.OrderID.Hex(), nil); rec.Code != http.StatusOK {
+		t.Fatalf("reissue got %d: %s", rec.Code, rec.Body)
+	}
+	if stored := s.get(order).PickupOTP; stored == nil || stored.Attempts != 0 {
+		t.Fatalf("reissued OTP is %+v, want no attempts", stored)
+	}
+
+	code = s.issuePickupOTP(order, time.Minute)
+	if rec := s.do(merchant, http.MethodPost, verify, gin.H{"otp": code}); rec.Code != http.StatusOK {
+		t.Fatalf("right code after reissue got %d: %s", rec.Code, rec.Body)
+	}
+	if picked := s.get(order); picked.Status != lifecycle.InTransit || picked.PickupOTP != nil || picked.DeliveryOTP == nil {
+		t.Errorf("order is %s with pickup OTP %+v and delivery OTP %+v, want In-Transit with only a delivery OTP",
+			picked.Status, picked.PickupOTP, picked.DeliveryOTP)
+	}
+}
+
+func TestPickupOTPExpires(t *testing.T) {
+	s := newTestServer(t)
+	merchant := s.login(3, "merchant")
+	order, code := s.awaitingPickup(-time.Second)
+
+	if rec := s.do(merchant, http.MethodPost, "/api/v1/merchant/verify/"+order.OrderID.Hex(), gin.H{"otp": code}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expired code got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if status := s.get(order).Status; status != lifecycle.Assigned {
+		t.Errorf("order is %s, want %s", status, lifecycle.Assigned)
+	}
+}
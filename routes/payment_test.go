@@ -0,0 +1,179 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// placeOrder places an order for two items as the customer and returns it.
+func (s *testServer) placeOrder(customer *http.Cookie) models.Order {
+	rec := s.do(customer, http.MethodPost, "/api/v1/customer/place", gin.H{
+		"storeID":     s.item.StoreID,
+		"items":       []gin.H{{"id": s.item.ID, "quantity": 2}},
+		"totalAmount": 5,
+	})
+	if rec.Code != http.StatusCreated {
+		s.t.Fatalf("place got %d: %s", rec.Code, rec.Body)
+	}
+	orders, _ := s.orders.ListByUser(context.Background(), 1)
+	return orders[len(orders)-1]
+}
+
+// paySuccess sends the checkout callback for paymentID.
+func (s *testServer) paySuccess(customer *http.Cookie, order models.Order, paymentID string) int {
+	rec := s.do(customer, http.MethodPost, "/api/v1/customer/pay/"+order.OrderID.Hex()+"/success", gin.H{
+		"paymentID": paymentID,
+		"signature": s.gateway.Sign(order.Payment.GatewayOrderID, paymentID),
+	})
+	return rec.Code
+}
+
+// webhook delivers a signed provider event.
+func (s *testServer) webhook(eventID string, event payment.WebhookEvent) int {
+	body, err := json.Marshal(event)
+	if err != nil {
+		s.t.Fatalf("marshal event: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/payments/webhook", bytes.NewReader(body))
+	req.Header.Set("X-Razorpay-Event-Id", eventID)
+	req.Header.Set("X-Razorpay-Signature", s.gateway.SignWebhook(body))
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// captured is the webhook event for a captured payment of the order.
+func captured(order models.Order, paymentID string) payment.WebhookEvent {
+	var event payment.WebhookEvent
+	event.Event = payment.EventPaymentCaptured
+	event.Payload.Payment.Entity = payment.PaymentEntity{
+		ID:      paymentID,
+		OrderID: order.Payment.GatewayOrderID,
+		Amount:  order.Payment.Amount,
+		Status:  "captured",
+	}
+	return event
+}
+
+func (s *testServer) get(order models.Order) models.Order {
+	stored, err := s.orders.Get(context.Background(), order.OrderID, repository.Scope{})
+	if err != nil {
+		s.t.Fatalf("order: %v", err)
+	}
+	return stored
+}
+
+func TestPaymentSuccessMarksOrderPaid(t *testing.T) {
+	s := newTestServer(t)
+	customer := s.login(1, "customer")
+	order := s.placeOrder(customer)
+
+	if code := s.paySuccess(customer, order, "pay_1"); code != http.StatusOK {
+		t.Fatalf("payment success got %d", code)
+	}
+	if paid := s.get(order); paid.Status != lifecycle.Paid || paid.Payment.PaymentID != "pay_1" {
+		t.Errorf("order is %s paid with %q, want Paid with pay_1", paid.Status, paid.Payment.PaymentID)
+	}
+
+	// The callback may be sent again, e.g. when the customer reloads
+	if code := s.paySuccess(customer, order, "pay_1"); code != http.StatusOK {
+		t.Errorf("repeated payment success got %d, want %d", code, http.StatusOK)
+	}
+	if refunds := s.get(order).Refunds; len(refunds) != 0 {
+		t.Errorf("repeated callback refunded %+v", refunds)
+	}
+}
+
+func TestPaymentSuccessAfterWebhook(t *testing.T) {
+	s := newTestServer(t)
+	customer := s.login(1, "customer")
+	order := s.placeOrder(customer)
+
+	if code := s.webhook("evt_1", captured(order, "pay_1")); code != http.StatusOK {
+		t.Fatalf("webhook got %d", code)
+	}
+	if code := s.paySuccess(customer, order, "pay_1"); code != http.StatusOK {
+		t.Errorf("payment success after the webhook got %d, want %d", code, http.StatusOK)
+	}
+	if paid := s.get(order); paid.Status != lifecycle.Paid || len(paid.Refunds) != 0 {
+		t.Errorf("order is %s with refunds %+v, want Paid without refunds", paid.Status, paid.Refunds)
+	}
+}
+
+func TestPaymentSuccessAfterCancelRefunds(t *testing.T) {
+	s := newTestServer(t)
+	customer := s.login(1, "customer")
+	order := s.placeOrder(customer)
+
+	if rec := s.do(customer, http.MethodPost, "/api/v1/customer/cancel/"+order.OrderID.Hex(), nil); rec.Code != http.StatusOK {
+		t.Fatalf("cancel got %d: %s", rec.Code, rec.Body)
+	}
+
+	if code := s.paySuccess(customer, order, "pay_1"); code != http.StatusConflict {
+		t.Errorf("payment success for a cancelled order got %d, want %d", code, http.StatusConflict)
+	}
+	s.paySuccess(customer, order, "pay_1")
+
+	cancelled := s.get(order)
+	if cancelled.Status != lifecycle.Cancelled {
+		t.Errorf("order is %s, want %s", cancelled.Status, lifecycle.Cancelled)
+	}
+	if len(cancelled.Refunds) != 1 {
+		t.Fatalf("order has %d refunds, want 1", len(cancelled.Refunds))
+	}
+	if refund := cancelled.Refunds[0]; refund.PaymentID != "pay_1" || refund.Amount != order.Payment.Amount || refund.Status != payment.RefundProcessed {
+		t.Errorf("refund = %+v, want the full payment of pay_1", refund)
+	}
+}
+
+func TestCancellationRefundsPaidLessFee(t *testing.T) {
+	tests := []struct {
+		name    string
+		confirm bool
+		user    uint
+		role    string
+		fee     int64
+	}{
+		{"customer before confirmation", false, 1, "customer", 0},
+		{"customer after confirmation", true, 1, "customer", 50},
+		{"merchant after confirmation", true, 3, "merchant", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			customer := s.login(1, "customer")
+			order := s.placeOrder(customer)
+			if code := s.paySuccess(customer, order, "pay_1"); code != http.StatusOK {
+				t.Fatalf("payment success got %d", code)
+			}
+			if tt.confirm {
+				if rec := s.do(s.login(3, "merchant"), http.MethodPost, "/api/v1/merchant/confirm/"+order.OrderID.Hex(), nil); rec.Code != http.StatusOK {
+					t.Fatalf("confirm got %d: %s", rec.Code, rec.Body)
+				}
+			}
+
+			rec := s.do(s.login(tt.user, tt.role), http.MethodPost, "/api/v1/"+tt.role+"/cancel/"+order.OrderID.Hex(), gin.H{"reasonCode": lifecycle.ReasonOther})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("cancel got %d: %s", rec.Code, rec.Body)
+			}
+
+			refunds := s.get(order).Refunds
+			if len(refunds) != 1 {
+				t.Fatalf("order has %d refunds, want 1", len(refunds))
+			}
+			if refund := refunds[0]; refund.Fee != tt.fee || refund.Amount != order.Payment.Amount-tt.fee {
+				t.Errorf("refunded %d with a fee of %d, want %d with a fee of %d", refund.Amount, refund.Fee, order.Payment.Amount-tt.fee, tt.fee)
+			}
+		})
+	}
+}
@@ -1,21 +1,37 @@
 package routes
 
 import (
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/board"
+	"github.com/CS559-CSD-IITBH/order-service/catalog"
 	"github.com/CS559-CSD-IITBH/order-service/controllers"
+	"github.com/CS559-CSD-IITBH/order-service/dispatch"
+	"github.com/CS559-CSD-IITBH/order-service/events"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
 	"github.com/CS559-CSD-IITBH/order-service/middlewares"
+	"github.com/CS559-CSD-IITBH/order-service/notification"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/CS559-CSD-IITBH/order-service/tracking"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/sessions"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func SetupRouter(order *mongo.Collection, cart *mongo.Collection, store *sessions.FilesystemStore) *gin.Engine {
+func SetupRouter(order repository.OrderRepository, cart repository.CartRepository, stores repository.StoreRepository, tx repository.Transactor, prices catalog.PriceSource, gateway payment.Gateway, webhookEvents repository.WebhookEventRepository, policy lifecycle.CancellationPolicy, issuer *otp.Issuer, notifier *notification.Dispatcher, pool *dispatch.Pool, agents *dispatch.Agents, tracker *tracking.Tracker, hub *events.Hub, orderBoard *board.Board, abandonedAfter time.Duration, allowedOrigins []string, store *sessions.FilesystemStore) *gin.Engine {
 	r := gin.Default()
 
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{"*"}
+	if len(allowedOrigins) > 0 {
+		config.AllowOrigins = allowedOrigins
+	}
 	r.Use(cors.New(config))
 
+	boardUpgrader := controllers.BoardUpgrader(allowedOrigins)
+
 	v1 := r.Group("/api/v1")
 	{
 		customers := v1.Group("/customer")
@@ -24,19 +40,73 @@ func SetupRouter(order *mongo.Collection, cart *mongo.Collection, store *session
 			customers.Use(auth)
 
 			customers.POST("/savecart", func(c *gin.Context) {
-				controllers.SaveCart(c, cart, store)
+				controllers.SaveCart(c, cart, prices, store)
 			})
 			customers.GET("/getcart", func(c *gin.Context) {
 				controllers.GetCart(c, cart, store)
 			})
+			customers.POST("/cart/items", func(c *gin.Context) {
+				controllers.AddCartItem(c, cart, prices, store)
+			})
+			customers.PATCH("/cart/items/:itemID", func(c *gin.Context) {
+				controllers.UpdateCartItem(c, cart, store)
+			})
+			customers.DELETE("/cart/items/:itemID", func(c *gin.Context) {
+				controllers.RemoveCartItem(c, cart, store)
+			})
+			customers.DELETE("/cart", func(c *gin.Context) {
+				controllers.ClearCart(c, cart, store)
+			})
 			customers.POST("/place", func(c *gin.Context) {
-				controllers.PlaceOrder(c, order, store)
+				controllers.PlaceOrder(c, order, prices, gateway, store)
+			})
+			customers.POST("/checkout", func(c *gin.Context) {
+				controllers.Checkout(c, order, cart, tx, prices, gateway, store)
+			})
+			customers.GET("/pay/:orderID", func(c *gin.Context) {
+				controllers.PayOrder(c, order, gateway, store)
+			})
+			customers.POST("/pay/:orderID/success", func(c *gin.Context) {
+				controllers.PaymentSuccess(c, order, gateway, store)
+			})
+			customers.POST("/pay/:orderID/failure", func(c *gin.Context) {
+				controllers.PaymentFailure(c, order, store)
 			})
 			customers.POST("/cancel/:orderID", func(c *gin.Context) {
-				controllers.CancelOrder(c, order, store)
+				controllers.CancelOrder(c, order, gateway, policy, store)
+			})
+			customers.POST("/otp/:orderID", func(c *gin.Context) {
+				controllers.ReissueDeliveryOTP(c, order, issuer, notifier, store)
 			})
 			customers.GET("/track/:orderID", func(c *gin.Context) {
-				controllers.TrackOrder(c, order, store)
+				controllers.TrackOrder(c, order, tracker, store)
+			})
+			customers.GET("/track/:orderID/stream", func(c *gin.Context) {
+				controllers.StreamOrder(c, order, hub, store)
+			})
+		}
+
+		payments := v1.Group("/payments")
+		{
+			// Called by the payment provider and authenticated by signature
+			payments.POST("/webhook", func(c *gin.Context) {
+				controllers.PaymentWebhook(c, order, webhookEvents, gateway)
+			})
+		}
+
+		admins := v1.Group("/admin")
+		{
+			auth := middlewares.SessionAuth(store, "admin")
+			admins.Use(auth)
+
+			admins.GET("/carts/abandoned", func(c *gin.Context) {
+				controllers.GetAbandonedCarts(c, cart, abandonedAfter)
+			})
+			admins.GET("/refunds/failed", func(c *gin.Context) {
+				controllers.GetFailedRefunds(c, order)
+			})
+			admins.POST("/refunds/:orderID/:refundID/retry", func(c *gin.Context) {
+				controllers.RetryRefund(c, order, gateway)
 			})
 		}
 
@@ -46,16 +116,25 @@ func SetupRouter(order *mongo.Collection, cart *mongo.Collection, store *session
 			merchants.Use(auth)
 
 			merchants.GET("/get", func(c *gin.Context) {
-				controllers.GetOrdersForMerchant(c, order, store)
+				controllers.GetOrdersForMerchant(c, order, stores, store)
+			})
+			merchants.GET("/board", func(c *gin.Context) {
+				controllers.MerchantBoard(c, orderBoard, stores, boardUpgrader, store)
 			})
 			merchants.POST("/confirm/:orderID", func(c *gin.Context) {
-				controllers.ConfirmOrder(c, order, store)
+				controllers.ConfirmOrder(c, order, stores, store)
+			})
+			merchants.POST("/adjust/:orderID", func(c *gin.Context) {
+				controllers.AdjustOrder(c, order, stores, gateway, store)
+			})
+			merchants.POST("/cancel/:orderID", func(c *gin.Context) {
+				controllers.CancelOrderByMerchant(c, order, stores, gateway, policy, store)
 			})
 			merchants.POST("/ready/:orderID", func(c *gin.Context) {
-				controllers.OrderReadyForPickup(c, order, store)
+				controllers.OrderReadyForPickup(c, order, stores, store)
 			})
 			merchants.POST("/verify/:orderID", func(c *gin.Context) {
-				controllers.VerifyPickup(c, order, store)
+				controllers.VerifyPickup(c, order, stores, issuer, notifier, store)
 			})
 		}
 
@@ -65,13 +144,31 @@ func SetupRouter(order *mongo.Collection, cart *mongo.Collection, store *session
 			deliveryAgents.Use(auth)
 
 			deliveryAgents.GET("/get", func(c *gin.Context) {
-				controllers.GetOrdersForDelivery(c, order, store)
+				controllers.GetOrdersForDelivery(c, order, pool, store)
+			})
+			deliveryAgents.GET("/status", func(c *gin.Context) {
+				controllers.GetAgentStatus(c, agents, store)
+			})
+			deliveryAgents.POST("/online", func(c *gin.Context) {
+				controllers.GoOnline(c, agents, store)
+			})
+			deliveryAgents.POST("/offline", func(c *gin.Context) {
+				controllers.GoOffline(c, agents, store)
 			})
 			deliveryAgents.POST("/accept/:orderID", func(c *gin.Context) {
-				controllers.AcceptOrder(c, order, store)
+				controllers.AcceptOrder(c, pool, issuer, notifier, store)
+			})
+			deliveryAgents.POST("/otp/:orderID", func(c *gin.Context) {
+				controllers.ReissuePickupOTP(c, order, issuer, notifier, store)
+			})
+			deliveryAgents.POST("/location/:orderID", func(c *gin.Context) {
+				controllers.UpdateLocation(c, tracker, store)
+			})
+			deliveryAgents.POST("/cancel/:orderID", func(c *gin.Context) {
+				controllers.CancelOrderByDelivery(c, order, gateway, policy, store)
 			})
 			deliveryAgents.POST("/verify/:orderID", func(c *gin.Context) {
-				controllers.VerifyDelivery(c, order, store)
+				controllers.VerifyDelivery(c, order, issuer, store)
 			})
 		}
 	}
@@ -0,0 +1,337 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/board"
+	"github.com/CS559-CSD-IITBH/order-service/catalog"
+	"github.com/CS559-CSD-IITBH/order-service/dispatch"
+	"github.com/CS559-CSD-IITBH/order-service/events"
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/notification"
+	"github.com/CS559-CSD-IITBH/order-service/otp"
+	"github.com/CS559-CSD-IITBH/order-service/payment"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"github.com/CS559-CSD-IITBH/order-service/tracking"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testServer is the router wired to the memory repositories.
+type testServer struct {
+	t       *testing.T
+	router  *gin.Engine
+	session *sessions.FilesystemStore
+	orders  *repository.MemoryOrders
+	carts   *repository.MemoryCarts
+	gateway *payment.Fake
+	hub     *events.Hub
+	board   *board.Board
+	item    catalog.Item
+}
+
+func newTestServer(t *testing.T) *testServer {
+	gin.SetMode(gin.TestMode)
+
+	storeID := models.NewStoreID()
+	item := catalog.Item{ID: primitive.NewObjectID(), StoreID: storeID, Name: "Tea", Price: 2.5}
+
+	gateway, err := payment.NewFake()
+	if err != nil {
+		t.Fatalf("NewFake: %v", err)
+	}
+	notifier := notification.NewDispatcher(notification.NewLogNotifier(io.Discard), 16)
+	t.Cleanup(notifier.Close)
+
+	orders := repository.NewMemoryOrders()
+	carts := repository.NewMemoryCarts()
+	agents := dispatch.NewAgents(repository.NewMemoryAgents(), orders, 1)
+	session := sessions.NewFilesystemStore(t.TempDir(), []byte("test-key"))
+	hub := events.NewHub()
+	orderBoard := board.NewBoard(repository.NewMemoryMerchantEvents())
+
+	router := SetupRouter(
+		orders, carts, repository.NewMemoryStores(models.Store{StoreID: storeID, MerchantID: 3}),
+		repository.MemoryTransactor{}, catalog.NewMemorySource(item), gateway,
+		repository.NewMemoryWebhookEvents(), lifecycle.DefaultCancellationPolicy(),
+		otp.NewIssuer("test-secret", time.Minute, 3), notifier,
+		dispatch.NewPool(orders, agents, notifier), agents,
+		tracking.NewTracker(orders, repository.NewMemoryTrail()), hub,
+		orderBoard, time.Hour, nil, session,
+	)
+	return &testServer{t: t, router: router, session: session, orders: orders, carts: carts, gateway: gateway, hub: hub, board: orderBoard, item: item}
+}
+
+// login returns the session cookie of a signed in user.
+func (s *testServer) login(userID uint, userType string) *http.Cookie {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := s.session.New(req, "session-name")
+	session.Values["user_id"] = userID
+	session.Values["user_type"] = userType
+	if err := session.Save(req, rec); err != nil {
+		s.t.Fatalf("save session: %v", err)
+	}
+	return rec.Result().Cookies()[0]
+}
+
+func (s *testServer) do(cookie *http.Cookie, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("marshal body: %v", err)
+		}
+		payload = bytes.NewReader(raw)
+	}
+	req := httptest.NewRequest(method, path, payload)
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// readyOrder stores an order that is waiting for a delivery agent.
+func (s *testServer) readyOrder() models.Order {
+	return s.orderIn(lifecycle.Ready)
+}
+
+// orderIn stores an order of customer 1 in the given status.
+func (s *testServer) orderIn(status string) models.Order {
+	order := models.Order{
+		OrderID:   primitive.NewObjectID(),
+		StoreID:   s.item.StoreID,
+		UserID:    1,
+		Status:    status,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := s.orders.Insert(context.Background(), order); err != nil {
+		s.t.Fatalf("insert order: %v", err)
+	}
+	return order
+}
+
+func TestRoutesRequireSession(t *testing.T) {
+	s := newTestServer(t)
+
+	if rec := s.do(nil, http.MethodGet, "/api/v1/customer/getcart", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("without a session got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	agent := s.login(5, "delivery_agent")
+	if rec := s.do(agent, http.MethodGet, "/api/v1/customer/getcart", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("as a delivery agent got %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestTransitionStatusCodes(t *testing.T) {
+	s := newTestServer(t)
+	merchant := s.login(3, "merchant")
+	cancel := gin.H{"reasonCode": lifecycle.ReasonOutOfStock}
+
+	tests := []struct {
+		name   string
+		status string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"allowed move", lifecycle.Paid, "/api/v1/merchant/confirm/", nil, http.StatusOK},
+		{"move that does not exist", lifecycle.PendingPayment, "/api/v1/merchant/confirm/", nil, http.StatusConflict},
+		{"move from a final status", lifecycle.Delivered, "/api/v1/merchant/cancel/", cancel, http.StatusConflict},
+		{"move reserved for other roles", lifecycle.InTransit, "/api/v1/merchant/cancel/", cancel, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := s.orderIn(tt.status)
+			if rec := s.do(merchant, http.MethodPost, tt.path+order.OrderID.Hex(), tt.body); rec.Code != tt.want {
+				t.Errorf("got %d: %s, want %d", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderOnlyTakesItemsFromTheClient(t *testing.T) {
+	s := newTestServer(t)
+	customer := s.login(1, "customer")
+
+	rec := s.do(customer, http.MethodPost, "/api/v1/customer/place", gin.H{
+		"storeID":     s.item.StoreID,
+		"items":       []gin.H{{"id": s.item.ID, "quantity": 2, "price": 0.01}},
+		"totalAmount": 5,
+		"userID":      99,
+		"status":      lifecycle.Delivered,
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("place got %d: %s", rec.Code, rec.Body)
+	}
+
+	orders, _ := s.orders.ListByUser(context.Background(), 1)
+	if len(orders) != 1 {
+		t.Fatalf("customer has %d orders, want 1", len(orders))
+	}
+	order := orders[0]
+	if order.Status != lifecycle.PendingPayment {
+		t.Errorf("status = %s, want %s", order.Status, lifecycle.PendingPayment)
+	}
+	if order.Items[0].Price != s.item.Price || order.TotalAmount != 5 {
+		t.Errorf("order priced at %v with total %v, want the catalog price", order.Items[0].Price, order.TotalAmount)
+	}
+
+	rec = s.do(customer, http.MethodPost, "/api/v1/customer/place", gin.H{
+		"storeID": s.item.StoreID,
+		"items":   []gin.H{{"id": s.item.ID, "quantity": 0}},
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("zero quantity got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPlaceOrderChecksTheTotal(t *testing.T) {
+	s := newTestServer(t)
+	customer := s.login(1, "customer")
+	items := []gin.H{{"id": s.item.ID, "quantity": 2}}
+
+	tests := []struct {
+		name string
+		body gin.H
+		want int
+	}{
+		{"missing total", gin.H{"storeID": s.item.StoreID, "items": items}, http.StatusBadRequest},
+		{"null total", gin.H{"storeID": s.item.StoreID, "items": items, "totalAmount": nil}, http.StatusBadRequest},
+		{"zero total", gin.H{"storeID": s.item.StoreID, "items": items, "totalAmount": 0}, http.StatusUnprocessableEntity},
+		{"wrong total", gin.H{"storeID": s.item.StoreID, "items": items, "totalAmount": 4.99}, http.StatusUnprocessableEntity},
+		{"matching total", gin.H{"storeID": s.item.StoreID, "items": items, "totalAmount": 5}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := s.do(customer, http.MethodPost, "/api/v1/customer/place", tt.body); rec.Code != tt.want {
+				t.Errorf("got %d: %s, want %d", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+
+	if orders, _ := s.orders.ListByUser(context.Background(), 1); len(orders) != 1 {
+		t.Errorf("customer has %d orders, want only the one with the matching total", len(orders))
+	}
+}
+
+func TestSaveCartPricesFromTheCatalog(t *testing.T) {
+	s := newTestServer(t)
+	customer := s.login(1, "customer")
+
+	rec := s.do(customer, http.MethodPost, "/api/v1/customer/savecart", gin.H{
+		"storeID":     s.item.StoreID,
+		"items":       []gin.H{{"id": s.item.ID, "name": "Gold", "quantity": 2, "price": 0.01, "lineTotal": 0.02}},
+		"totalAmount": 0.02,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("save cart got %d: %s", rec.Code, rec.Body)
+	}
+
+	cart, err := s.carts.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("cart: %v", err)
+	}
+	line := cart.Items[0]
+	if line.Name != s.item.Name || line.Price != s.item.Price || line.LineTotal != 5 || cart.TotalAmount != 5 {
+		t.Errorf("cart saved as %+v with total %v, want the catalog price and a total of 5", line, cart.TotalAmount)
+	}
+
+	rec = s.do(customer, http.MethodPost, "/api/v1/customer/savecart", gin.H{
+		"storeID": s.item.StoreID,
+		"items":   []gin.H{{"id": s.item.ID, "quantity": -1, "price": 2.5}},
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("negative quantity got %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCheckoutPlacesOneOrderAndClearsCart(t *testing.T) {
+	s := newTestServer(t)
+	customer := s.login(1, "customer")
+
+	rec := s.do(customer, http.MethodPost, "/api/v1/customer/cart/items", gin.H{
+		"storeID": s.item.StoreID, "itemID": s.item.ID, "quantity": 3,
+	})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("add item got %d: %s", rec.Code, rec.Body)
+	}
+
+	if rec := s.do(customer, http.MethodPost, "/api/v1/customer/checkout", nil); rec.Code != http.StatusCreated {
+		t.Fatalf("checkout got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(customer, http.MethodPost, "/api/v1/customer/checkout", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second checkout got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	if _, err := s.carts.Get(context.Background(), 1); err != repository.ErrNotFound {
+		t.Errorf("cart after checkout: %v, want ErrNotFound", err)
+	}
+	orders, _ := s.orders.ListByUser(context.Background(), 1)
+	if len(orders) != 1 || orders[0].TotalAmount != 7.5 {
+		t.Errorf("customer has %+v, want one order of 7.5", orders)
+	}
+}
+
+func TestTrackOrderIsScopedToTheCustomer(t *testing.T) {
+	s := newTestServer(t)
+	order := s.readyOrder()
+
+	owner := s.login(1, "customer")
+	if rec := s.do(owner, http.MethodGet, "/api/v1/customer/track/"+order.OrderID.Hex(), nil); rec.Code != http.StatusOK {
+		t.Errorf("owner got %d: %s", rec.Code, rec.Body)
+	}
+	other := s.login(2, "customer")
+	if rec := s.do(other, http.MethodGet, "/api/v1/customer/track/"+order.OrderID.Hex(), nil); rec.Code != http.StatusNotFound {
+		t.Errorf("other customer got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestAcceptOrderRespectsCapacity(t *testing.T) {
+	s := newTestServer(t)
+	first, second := s.readyOrder(), s.readyOrder()
+	agent := s.login(5, "delivery_agent")
+
+	if rec := s.do(agent, http.MethodPost, "/api/v1/deliveryagent/accept/"+first.OrderID.Hex(), nil); rec.Code != http.StatusConflict {
+		t.Errorf("accept while offline got %d, want %d", rec.Code, http.StatusConflict)
+	}
+	if rec := s.do(agent, http.MethodPost, "/api/v1/deliveryagent/online", gin.H{"capacity": 1}); rec.Code != http.StatusOK {
+		t.Fatalf("online got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(agent, http.MethodPost, "/api/v1/deliveryagent/accept/"+first.OrderID.Hex(), nil); rec.Code != http.StatusOK {
+		t.Fatalf("accept got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := s.do(agent, http.MethodPost, "/api/v1/deliveryagent/accept/"+second.OrderID.Hex(), nil); rec.Code != http.StatusConflict {
+		t.Errorf("accept over capacity got %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	claimed, err := s.orders.Get(context.Background(), first.OrderID, repository.Agent(5))
+	if err != nil {
+		t.Fatalf("claimed order: %v", err)
+	}
+	if claimed.Status != lifecycle.Assigned || claimed.PickupOTP == nil {
+		t.Errorf("claimed order is %s with pickup OTP %v, want Assigned with an OTP", claimed.Status, claimed.PickupOTP)
+	}
+	if _, err := s.orders.Get(context.Background(), first.OrderID, repository.Unassigned()); err != repository.ErrNotFound {
+		t.Errorf("claimed order still unassigned: %v", err)
+	}
+
+	other := s.login(6, "delivery_agent")
+	s.do(other, http.MethodPost, "/api/v1/deliveryagent/online", nil)
+	if rec := s.do(other, http.MethodPost, "/api/v1/deliveryagent/accept/"+first.OrderID.Hex(), nil); rec.Code == http.StatusOK {
+		t.Errorf("a second agent took an assigned order")
+	}
+}
@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+)
+
+// sseEvent reads the next event name and data from a Server-Sent Events
+// stream.
+func sseEvent(t *testing.T, r *bufio.Reader) (string, string) {
+	t.Helper()
+	var name, data string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimPrefix(line, "event:")
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimPrefix(line, "data:")
+		}
+	}
+}
+
+func TestStreamDeliversStatusChanges(t *testing.T) {
+	s := newTestServer(t)
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+	order := s.orderIn(lifecycle.Paid)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/v1/customer/track/"+order.OrderID.Hex()+"/stream", nil)
+	req.AddCookie(s.login(1, "customer"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream got %d", resp.StatusCode)
+	}
+	stream := bufio.NewReader(resp.Body)
+
+	if name, data := sseEvent(t, stream); name != "status" || !strings.Contains(data, `"status":"Paid"`) {
+		t.Fatalf("first event = %s %s, want the current Paid status", name, data)
+	}
+
+	for _, status := range []string{lifecycle.Confirmed, lifecycle.Cancelled} {
+		s.hub.OrderTransitioned(order, models.StatusChange{From: order.Status, To: status, At: time.Now().UTC()})
+		if name, data := sseEvent(t, stream); name != "status" || !strings.Contains(data, `"status":"`+status+`"`) {
+			t.Errorf("got %s %s, want the %s status", name, data, status)
+		}
+	}
+
+	// The stream ends once the order reaches a final status
+	if _, err := stream.ReadString('\n'); err == nil {
+		t.Error("stream stayed open after the order was cancelled")
+	}
+}
+
+func TestStreamIsScopedToTheCustomer(t *testing.T) {
+	s := newTestServer(t)
+	order := s.orderIn(lifecycle.Paid)
+
+	if rec := s.do(s.login(2, "customer"), http.MethodGet, "/api/v1/customer/track/"+order.OrderID.Hex()+"/stream", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("another customer got %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,125 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TrailLimit is the most trail points returned for an order.
+const TrailLimit = 500
+
+// maxClockSkew is how far in the future a reported timestamp may be.
+const maxClockSkew = time.Minute
+
+var (
+	ErrNotFound         = errors.New("order not found or not out for delivery")
+	ErrInvalidPoint     = errors.New("location must be a GeoJSON Point with [longitude, latitude] coordinates")
+	ErrInvalidTimestamp = errors.New("recordedAt is in the future")
+)
+
+// Listener is called after a position becomes the latest one for an order.
+// Listeners run on the request path and must not block.
+type Listener func(orderID primitive.ObjectID, location models.Location)
+
+// Tracker records the positions delivery agents report while carrying an
+// order. The latest position is kept on the order and every position is
+// appended to the order's trail.
+type Tracker struct {
+	orders repository.OrderRepository
+	trail  repository.TrailRepository
+
+	listenersMu sync.RWMutex
+	listeners   []Listener
+}
+
+func NewTracker(orders repository.OrderRepository, trail repository.TrailRepository) *Tracker {
+	return &Tracker{orders: orders, trail: trail}
+}
+
+// Listen registers a listener for new latest positions.
+func (t *Tracker) Listen(l Listener) {
+	t.listenersMu.Lock()
+	defer t.listenersMu.Unlock()
+	t.listeners = append(t.listeners, l)
+}
+
+func (t *Tracker) notify(orderID primitive.ObjectID, location models.Location) {
+	t.listenersMu.RLock()
+	defer t.listenersMu.RUnlock()
+	for _, l := range t.listeners {
+		l(orderID, location)
+	}
+}
+
+// Validate checks that point is a GeoJSON point with a valid longitude and
+// latitude.
+func Validate(point models.GeoPoint) error {
+	if point.Type != "Point" || len(point.Coordinates) != 2 {
+		return ErrInvalidPoint
+	}
+	lng, lat := point.Coordinates[0], point.Coordinates[1]
+	if lng < -180 || lng > 180 || lat < -90 || lat > 90 {
+		return ErrInvalidPoint
+	}
+	return nil
+}
+
+// Record stores a position for an order assigned to the agent, which must be
+// out for delivery. A zero recordedAt means now. Positions that arrive out of
+// order are added to the trail without replacing a newer latest position.
+func (t *Tracker) Record(ctx context.Context, orderID primitive.ObjectID, agentID models.AgentID, point models.GeoPoint, recordedAt time.Time) (models.Location, error) {
+	if err := Validate(point); err != nil {
+		return models.Location{}, err
+	}
+
+	now := time.Now().UTC()
+	if recordedAt.IsZero() {
+		recordedAt = now
+	}
+	if recordedAt.After(now.Add(maxClockSkew)) {
+		return models.Location{}, ErrInvalidTimestamp
+	}
+	location := models.Location{Point: point, RecordedAt: recordedAt.UTC()}
+
+	order, err := t.orders.Get(ctx, orderID, repository.Agent(agentID))
+	if errors.Is(err, repository.ErrNotFound) {
+		return models.Location{}, ErrNotFound
+	}
+	if err != nil {
+		return models.Location{}, err
+	}
+	if !lifecycle.Tracked(order.Status) {
+		return models.Location{}, ErrNotFound
+	}
+
+	err = t.trail.Add(ctx, models.TrailPoint{
+		OrderID:    order.OrderID,
+		AgentID:    order.DeliveryInfo.DeliveryAgentID,
+		Point:      location.Point,
+		RecordedAt: location.RecordedAt,
+	})
+	if err != nil {
+		return models.Location{}, err
+	}
+
+	latest, err := t.orders.SetLocation(ctx, order.OrderID, location)
+	if err != nil {
+		return models.Location{}, err
+	}
+	if latest {
+		t.notify(order.OrderID, location)
+	}
+	return location, nil
+}
+
+// Trail returns the most recent positions recorded for an order, oldest first.
+func (t *Tracker) Trail(ctx context.Context, orderID primitive.ObjectID) ([]models.TrailPoint, error) {
+	return t.trail.Recent(ctx, orderID, TrailLimit)
+}
@@ -0,0 +1,132 @@
+package tracking
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CS559-CSD-IITBH/order-service/lifecycle"
+	"github.com/CS559-CSD-IITBH/order-service/models"
+	"github.com/CS559-CSD-IITBH/order-service/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func point(lng, lat float64) models.GeoPoint {
+	return models.GeoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		point models.GeoPoint
+		valid bool
+	}{
+		{"point", point(81.6, 21.2), true},
+		{"corners", point(-180, 90), true},
+		{"other corners", point(180, -90), true},
+		{"longitude too small", point(-180.1, 0), false},
+		{"longitude too large", point(180.1, 0), false},
+		{"latitude too small", point(0, -90.1), false},
+		{"latitude too large", point(0, 90.1), false},
+		{"latitude first", point(21.2, 181.6), false},
+		{"not a point", models.GeoPoint{Type: "LineString", Coordinates: []float64{81.6, 21.2}}, false},
+		{"missing latitude", models.GeoPoint{Type: "Point", Coordinates: []float64{81.6}}, false},
+		{"altitude", models.GeoPoint{Type: "Point", Coordinates: []float64{81.6, 21.2, 300}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.point)
+			if tt.valid && err != nil {
+				t.Errorf("Validate = %v, want nil", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidPoint) {
+				t.Errorf("Validate = %v, want ErrInvalidPoint", err)
+			}
+		})
+	}
+}
+
+// carriedOrder stores an order delivery agent 5 is carrying.
+func carriedOrder(t *testing.T, orders *repository.MemoryOrders, status string) models.Order {
+	order := models.Order{
+		OrderID:      primitive.NewObjectID(),
+		StoreID:      models.NewStoreID(),
+		UserID:       1,
+		Status:       status,
+		DeliveryInfo: models.DeliveryInfo{DeliveryAgentID: 5},
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := orders.Insert(context.Background(), order); err != nil {
+		t.Fatalf("insert order: %v", err)
+	}
+	return order
+}
+
+func TestRecordKeepsNewestPosition(t *testing.T) {
+	orders := repository.NewMemoryOrders()
+	tracker := NewTracker(orders, repository.NewMemoryTrail())
+	order := carriedOrder(t, orders, lifecycle.InTransit)
+
+	var notified []models.Location
+	tracker.Listen(func(_ primitive.ObjectID, location models.Location) {
+		notified = append(notified, location)
+	})
+
+	now := time.Now().UTC().Truncate(time.Second)
+	if _, err := tracker.Record(context.Background(), order.OrderID, 5, point(81.7, 21.3), now); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+	// A position delayed in transit arrives after a newer one
+	if _, err := tracker.Record(context.Background(), order.OrderID, 5, point(81.6, 21.2), now.Add(-time.Minute)); err != nil {
+		t.Fatalf("Record: %v", err)
+	}
+
+	stored, _ := orders.Get(context.Background(), order.OrderID, repository.Scope{})
+	if last := stored.DeliveryInfo.LastLocation; last == nil || !last.RecordedAt.Equal(now) {
+		t.Errorf("latest position is %+v, want the one recorded at %s", last, now)
+	}
+	if len(notified) != 1 || !notified[0].RecordedAt.Equal(now) {
+		t.Errorf("listeners saw %+v, want only the newest position", notified)
+	}
+
+	trail, err := tracker.Trail(context.Background(), order.OrderID)
+	if err != nil {
+		t.Fatalf("Trail: %v", err)
+	}
+	if len(trail) != 2 || !trail[0].RecordedAt.Before(trail[1].RecordedAt) {
+		t.Errorf("trail = %+v, want both positions oldest first", trail)
+	}
+}
+
+func TestRecordRejects(t *testing.T) {
+	orders := repository.NewMemoryOrders()
+	tracker := NewTracker(orders, repository.NewMemoryTrail())
+	carried := carriedOrder(t, orders, lifecycle.InTransit)
+	ready := carriedOrder(t, orders, lifecycle.Ready)
+
+	tests := []struct {
+		name    string
+		orderID primitive.ObjectID
+		agentID models.AgentID
+		point   models.GeoPoint
+		at      time.Time
+		want    error
+	}{
+		{"invalid coordinates", carried.OrderID, 5, point(0, 91), time.Time{}, ErrInvalidPoint},
+		{"future timestamp", carried.OrderID, 5, point(81.6, 21.2), time.Now().Add(time.Hour), ErrInvalidTimestamp},
+		{"another agent's order", carried.OrderID, 6, point(81.6, 21.2), time.Time{}, ErrNotFound},
+		{"order not out for delivery", ready.OrderID, 5, point(81.6, 21.2), time.Time{}, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tracker.Record(context.Background(), tt.orderID, tt.agentID, tt.point, tt.at); !errors.Is(err, tt.want) {
+				t.Errorf("Record = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if trail, _ := tracker.Trail(context.Background(), carried.OrderID); len(trail) != 0 {
+		t.Errorf("rejected positions were added to the trail: %+v", trail)
+	}
+}